@@ -0,0 +1,202 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/rediskv"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// config is the configuration read from the config file
+type config struct {
+	// Decoders select the decoders of the values of keys, the first rule
+	// with a matching pattern is used
+	Decoders []decoderRule `yaml:"decoders"`
+	// Protobuf is the protobuf descriptor set file (protoc
+	// --descriptor_set_out) holding the messages named in decoder chains
+	Protobuf string `yaml:"protobuf"`
+	// Profiles are the named connections, selected with -profile or
+	// picked when kvui is started without arguments
+	Profiles map[string]*profile `yaml:"profiles"`
+}
+
+// decoderRule decodes the values of keys matching the glob pattern Keys
+// with the decoders in Chain, like [gzip, msgpack] or [protobuf:pkg.Message]
+type decoderRule struct {
+	Keys  string   `yaml:"keys"`
+	Chain []string `yaml:"chain"`
+}
+
+// profile is a named connection to a KV-store
+type profile struct {
+	// Type is the KV-storage type, redis when empty
+	Type string `yaml:"type"`
+	// URL is the Redis URL to connect to, it is used instead of Host, Port,
+	// Username, Password and TLS
+	URL  string `yaml:"url"`
+	Host string `yaml:"host"`
+	Port uint   `yaml:"port"`
+	// File is the database file of file based KV-storages like bolt
+	File     string      `yaml:"file"`
+	Username string      `yaml:"username"`
+	Password string      `yaml:"password"`
+	TLS      *profileTLS `yaml:"tls"`
+	// DB is the database selected after connecting
+	DB int `yaml:"db"`
+	// ReadOnly refuses editing, creating and deleting keys
+	ReadOnly bool `yaml:"readonly"`
+	// Decoders are tried before the decoders of the config
+	Decoders []decoderRule `yaml:"decoders"`
+}
+
+// profileTLS enables TLS for Redis, with the CA, client certificate and
+// key files when set
+type profileTLS struct {
+	CA         string `yaml:"ca"`
+	Cert       string `yaml:"cert"`
+	Key        string `yaml:"key"`
+	Insecure   bool   `yaml:"insecure"`
+	ServerName string `yaml:"servername"`
+}
+
+// defaultPorts holds the port of KV-storage types when a profile has none
+var defaultPorts = map[string]uint{
+	kv.TypeRedis:     6379,
+	kv.TypeMemcached: 11211,
+}
+
+// kvType returns the KV-storage type of p
+func (p *profile) kvType() string {
+	if p.Type == "" {
+		return kv.TypeRedis
+	}
+	return p.Type
+}
+
+// describe names the KV-store of p without credentials, like host:port
+func (p *profile) describe() string {
+	if p.File != "" {
+		return filepath.Base(p.File)
+	}
+	if p.URL != "" {
+		if u, err := url.Parse(p.URL); err == nil && u.Host != "" {
+			return u.Host
+		}
+		return p.kvType()
+	}
+	params, _ := (&profile{Type: p.Type, Host: p.Host, Port: p.Port}).params()
+	return params
+}
+
+// database returns the database selected after connecting with p, the
+// one of the profile or else the one in the Redis URL
+func (p *profile) database() int {
+	if p.DB != 0 || p.URL == "" || p.kvType() != kv.TypeRedis {
+		return p.DB
+	}
+	if opts, err := rediskv.ParseURL(p.URL); err == nil {
+		return opts.DB
+	}
+	return 0
+}
+
+// params returns the parameters passed to kv.New for p. Credentials and
+// TLS of Redis result in a redis:// or rediss:// URL, like -url takes.
+func (p *profile) params() (string, error) {
+	if p.File != "" {
+		return expandHome(p.File), nil
+	}
+	if p.URL != "" {
+		return p.URL, nil
+	}
+	host, port := p.Host, p.Port
+	if host == "" {
+		host = "localhost"
+	}
+	if port == 0 {
+		port = defaultPorts[p.kvType()]
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	if p.kvType() != kv.TypeRedis || (p.Username == "" && p.Password == "" && p.TLS == nil) {
+		return addr, nil
+	}
+	if p.Username != "" && p.Password == "" {
+		return "", fmt.Errorf("username %s without password", p.Username)
+	}
+	u := &url.URL{Scheme: "redis", Host: addr}
+	if p.Password != "" {
+		u.User = url.UserPassword(p.Username, p.Password)
+	}
+	if p.TLS != nil {
+		u.Scheme = "rediss"
+		q := url.Values{}
+		for name, value := range map[string]string{
+			"ca":         expandHome(p.TLS.CA),
+			"cert":       expandHome(p.TLS.Cert),
+			"key":        expandHome(p.TLS.Key),
+			"servername": p.TLS.ServerName,
+		} {
+			if value != "" {
+				q.Set(name, value)
+			}
+		}
+		if p.TLS.Insecure {
+			q.Set("insecure", "true")
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String(), nil
+}
+
+// defaultConfigFile returns the path of the config file in the user's
+// config directory
+func defaultConfigFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(dir, "kvui", "config.yaml")
+}
+
+// expandHome replaces a leading ~ in path by the home directory
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.Getenv("HOME"), path[1:])
+	}
+	return path
+}
+
+// loadConfig reads the config file at path, a missing file results in an
+// empty config
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	data, err := ioutil.ReadFile(expandHome(path))
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	for name, p := range cfg.Profiles {
+		if p == nil || reflect.DeepEqual(*p, profile{}) {
+			return nil, fmt.Errorf("%s: profile %s is empty", path, name)
+		}
+	}
+	return cfg, nil
+}
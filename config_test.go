@@ -0,0 +1,65 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+
+	tests := []struct {
+		config string
+		ok     bool
+	}{
+		{"profiles:\n  dev:\n    host: dev\n", true},
+		{"profiles: {dev: }\n", false},
+		{"profiles:\n  dev: {}\n", false},
+	}
+	for _, tt := range tests {
+		if err := ioutil.WriteFile(path, []byte(tt.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := loadConfig(path)
+		if tt.ok && (err != nil || cfg.Profiles["dev"].Host != "dev") {
+			t.Errorf("loadConfig(%q) failed: %v", tt.config, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("loadConfig(%q) must fail on an empty profile", tt.config)
+		}
+	}
+
+	if cfg, err := loadConfig(filepath.Join(dir, "missing.yaml")); err != nil || len(cfg.Profiles) != 0 {
+		t.Errorf("a missing config file must result in an empty config: %v", err)
+	}
+}
+
+func TestProfileDatabase(t *testing.T) {
+	tests := []struct {
+		p  profile
+		db int
+	}{
+		{profile{Host: "dev"}, 0},
+		{profile{Host: "dev", DB: 2}, 2},
+		{profile{URL: "redis://dev/3"}, 3},
+		{profile{URL: "redis://dev?db=4"}, 4},
+		{profile{URL: "redis://dev/3", DB: 5}, 5},
+		{profile{URL: "redis://dev/invalid"}, 0},
+	}
+	for _, tt := range tests {
+		if db := tt.p.database(); db != tt.db {
+			t.Errorf("database of %+v = %d, want %d", tt.p, db, tt.db)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jroimartin/gocui"
+	"github.com/rikvdh/kvui/kv"
+)
+
+const (
+	createView = "create"
+	// createForm is filled in in the create view, the cursor starts on
+	// the name line
+	createForm = `# type is string, map, list, set or zset, ttl is optional (30s, 1h)
+# below the line the string, or one element per line:
+# map fields as field=value, sorted set members as score member
+name:
+type: string
+ttl:
+---
+`
+	createNameLine = 3
+)
+
+// newKey is a key to create, as filled in in the create view
+type newKey struct {
+	name    string
+	kind    string
+	ttl     time.Duration
+	str     string
+	items   []interface{}
+	fields  [][2]string
+	members []kv.Z
+}
+
+// parseNewKey parses the filled in create form
+func parseNewKey(form string) (*newKey, error) {
+	k := &newKey{kind: "string"}
+	lines := strings.Split(form, "\n")
+	var body []string
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "---" {
+			body = lines[i+1:]
+			break
+		}
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.SplitN(line, ":", 2)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("invalid line: %s", line)
+		}
+		value := strings.TrimSpace(f[1])
+		switch strings.TrimSpace(f[0]) {
+		case "name":
+			k.name = value
+		case "type":
+			k.kind = value
+		case "ttl":
+			if value == "" {
+				break
+			}
+			ttl, err := parseTTL(value)
+			if err != nil {
+				return nil, err
+			}
+			k.ttl = ttl
+		default:
+			return nil, fmt.Errorf("invalid line: %s", line)
+		}
+	}
+	if k.name == "" {
+		return nil, fmt.Errorf("the key needs a name")
+	}
+
+	if k.kind == "string" {
+		k.str = strings.Join(body, "\n")
+		return k, nil
+	}
+	for _, line := range body {
+		if line == "" {
+			continue
+		}
+		switch k.kind {
+		case "list", "set":
+			k.items = append(k.items, line)
+		case "map":
+			f := strings.SplitN(line, "=", 2)
+			if len(f) != 2 {
+				return nil, fmt.Errorf("invalid map field, expected field=value: %s", line)
+			}
+			k.fields = append(k.fields, [2]string{f[0], f[1]})
+		case "zset":
+			f := strings.SplitN(line, " ", 2)
+			score, err := strconv.ParseFloat(f[0], 64)
+			if len(f) != 2 || err != nil {
+				return nil, fmt.Errorf("invalid sorted set member, expected score member: %s", line)
+			}
+			k.members = append(k.members, kv.Z{Score: score, Member: f[1]})
+		default:
+			return nil, fmt.Errorf("invalid type: %s", k.kind)
+		}
+	}
+	if len(k.items)+len(k.fields)+len(k.members) == 0 {
+		return nil, fmt.Errorf("a %s needs at least one element", k.kind)
+	}
+	return k, nil
+}
+
+// create writes the key to the KV-store, existing keys are left alone
+func (k *newKey) create(ctx context.Context, store kv.KV) error {
+	_, err := store.Type(ctx, k.name)
+	if err == nil {
+		return fmt.Errorf("key %s already exists", k.name)
+	}
+	if _, ok := err.(*kv.NotFoundError); !ok {
+		return err
+	}
+	switch k.kind {
+	case "string":
+		err = store.Set(ctx, k.name, k.str)
+	case "map":
+		for _, f := range k.fields {
+			if err = store.HSet(ctx, k.name, f[0], f[1]); err != nil {
+				break
+			}
+		}
+	case "list":
+		err = store.RPush(ctx, k.name, k.items...)
+	case "set":
+		err = store.SAdd(ctx, k.name, k.items...)
+	case "zset":
+		err = store.ZAdd(ctx, k.name, k.members...)
+	}
+	if err == nil && k.ttl > 0 {
+		err = store.Expire(ctx, k.name, k.ttl)
+	}
+	return err
+}
+
+// createKey opens the create view with an empty form
+func createKey(g *gocui.Gui, v *gocui.View) error {
+	if !writable(g) {
+		return nil
+	}
+	sizeX, sizeY := g.Size()
+	cv, err := g.SetView(createView, treeSize+1, viewTop(), sizeX-1, sizeY-4)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	cv.Title = "new key (ctrl-s creates, esc cancels)"
+	cv.Editable = true
+	cv.Wrap = false
+	cv.Clear()
+	fmt.Fprint(cv, createForm)
+	cv.SetOrigin(0, 0)
+	cv.SetCursor(len("name: "), createNameLine)
+	_, err = g.SetCurrentView(createView)
+	return err
+}
+
+// closeCreate removes the create view and gives the focus back to currentView
+func closeCreate(g *gocui.Gui) error {
+	if err := g.DeleteView(createView); err != nil {
+		return err
+	}
+	_, err := g.SetCurrentView(currentView)
+	return err
+}
+
+// createSave creates the key filled in in the create view and selects it
+// in the tree, the create view stays open when it fails
+func createSave(g *gocui.Gui, v *gocui.View) error {
+	k, err := parseNewKey(strings.TrimSuffix(v.Buffer(), "\n"))
+	if err != nil {
+		showError(g, err)
+		return nil
+	}
+	kvfetch.fetch("", func(ctx context.Context, store kv.KV) (interface{}, error) {
+		return nil, k.create(ctx, store)
+	}, func(g *gocui.Gui, res interface{}, err error) error {
+		if err != nil {
+			showError(g, err)
+			return nil
+		}
+		if _, verr := g.View(createView); verr == nil {
+			if err := closeCreate(g); err != nil {
+				return err
+			}
+		}
+		if treeFilter.match(k.name) {
+			treeRoot.insert(k.name)
+		}
+		if k.ttl > 0 {
+			setExpiry(k.name, k.ttl)
+		}
+		return selectKey(g, k.name)
+	})
+	return nil
+}
+
+func createCancel(g *gocui.Gui, v *gocui.View) error {
+	return closeCreate(g)
+}
@@ -0,0 +1,157 @@
+package decode
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+)
+
+const (
+	// maxDecoded limits the size of decompressed values, a small value
+	// can expand to gigabytes otherwise
+	maxDecoded = 64 << 20
+	// maxSnappyRatio bounds the length a snappy block claims to decode to,
+	// relative to its own length, snappy does not compress much better
+	maxSnappyRatio = 32
+)
+
+var errTooLarge = errors.New("decompressed value too large")
+
+// readLimited reads r up to maxDecoded bytes, it fails when r holds more
+func readLimited(r io.Reader) ([]byte, error) {
+	out, err := ioutil.ReadAll(io.LimitReader(r, maxDecoded+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxDecoded {
+		return nil, errTooLarge
+	}
+	return out, nil
+}
+
+// snappyBlockLen returns the decoded length of a snappy block, it fails
+// when that length is implausible for the size of the block
+func snappyBlockLen(data []byte) (int, error) {
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return 0, err
+	}
+	if n > maxDecoded || n > maxSnappyRatio*len(data)+1024 {
+		return 0, errTooLarge
+	}
+	return n, nil
+}
+
+func init() {
+	Register(gzipDecoder{})
+	Register(zlibDecoder{})
+	Register(snappyDecoder{})
+	Register(base64Decoder{})
+}
+
+// gzipDecoder decompresses gzip data
+type gzipDecoder struct{}
+
+func (gzipDecoder) Name() string { return "gzip" }
+
+func (gzipDecoder) Sniff(data []byte) bool {
+	return len(data) >= 18 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+func (gzipDecoder) Decode(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r)
+}
+
+// zlibDecoder decompresses zlib data
+type zlibDecoder struct{}
+
+func (zlibDecoder) Name() string { return "zlib" }
+
+// Sniff checks the deflate method and the header checksum
+func (zlibDecoder) Sniff(data []byte) bool {
+	return len(data) >= 6 && data[0]&0x0f == 8 && data[0]>>4 <= 7 &&
+		(uint(data[0])<<8|uint(data[1]))%31 == 0
+}
+
+func (zlibDecoder) Decode(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r)
+}
+
+// snappyStream is the start of the snappy framing format
+var snappyStream = []byte("\xff\x06\x00\x00sNaPpY")
+
+// snappyDecoder decompresses snappy data, in block or framing format
+type snappyDecoder struct{}
+
+func (snappyDecoder) Name() string { return "snappy" }
+
+// Sniff recognizes the framing format by its header, blocks have no
+// signature so they have to decode to something plausible
+func (d snappyDecoder) Sniff(data []byte) bool {
+	if bytes.HasPrefix(data, snappyStream) {
+		return true
+	}
+	if len(data) < 4 {
+		return false
+	}
+	if _, err := snappyBlockLen(data); err != nil {
+		return false
+	}
+	out, err := snappy.Decode(nil, data)
+	return err == nil && plausible(out)
+}
+
+func (snappyDecoder) Decode(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(data, snappyStream) {
+		return readLimited(snappy.NewReader(bytes.NewReader(data)))
+	}
+	if _, err := snappyBlockLen(data); err != nil {
+		return nil, err
+	}
+	return snappy.Decode(nil, data)
+}
+
+// base64Decoder decodes standard or URL base64, with or without padding
+type base64Decoder struct{}
+
+func (base64Decoder) Name() string { return "base64" }
+
+// Sniff only accepts base64 of plausible data, as many words are valid
+// base64 too
+func (d base64Decoder) Sniff(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	out, err := d.Decode(data)
+	return err == nil && plausible(out)
+}
+
+func (base64Decoder) Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	encodings := []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding}
+	var err error
+	for _, enc := range encodings {
+		out := make([]byte, enc.DecodedLen(len(data)))
+		var n int
+		if n, err = enc.Decode(out, data); err == nil {
+			return out[:n], nil
+		}
+	}
+	return nil, err
+}
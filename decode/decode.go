@@ -0,0 +1,145 @@
+// Package decode transforms stored values for display. Decoders unwrap
+// compression and encodings like gzip and base64, or turn binary formats
+// like msgpack and protobuf into JSON. They are combined in chains, which
+// can be detected by sniffing the value.
+package decode
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxChain is the maximum number of decoders applied by Auto
+const maxChain = 8
+
+// Decoder transforms a value for display
+type Decoder interface {
+	// Name identifies the decoder in chains, like "gzip"
+	Name() string
+	// Sniff reports whether data looks like it is encoded for the
+	// decoder. Decoders for formats without a signature never sniff.
+	Sniff(data []byte) bool
+	Decode(data []byte) ([]byte, error)
+}
+
+var decoders = make(map[string]Decoder)
+
+// sniffOrder is the order in which Auto tries the decoders
+var sniffOrder []Decoder
+
+// Register makes a decoder available by its name, decoders are sniffed
+// in the order they are registered
+func Register(d Decoder) {
+	if _, dup := decoders[d.Name()]; dup {
+		panic("decode: Register called twice for decoder " + d.Name())
+	}
+	decoders[d.Name()] = d
+	sniffOrder = append(sniffOrder, d)
+}
+
+// Get returns the registered decoder with the given name
+func Get(name string) (Decoder, error) {
+	d, ok := decoders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown decoder: %s", name)
+	}
+	return d, nil
+}
+
+// Names returns the sorted names of the registered decoders
+func Names() []string {
+	var names []string
+	for name := range decoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Chain is a sequence of decoders applied one after the other
+type Chain []Decoder
+
+// ParseChain returns the chain of registered decoders named in names
+func ParseChain(names []string) (Chain, error) {
+	var c Chain
+	for _, name := range names {
+		d, err := Get(name)
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, d)
+	}
+	return c, nil
+}
+
+func (c Chain) String() string {
+	names := make([]string, len(c))
+	for i, d := range c {
+		names[i] = d.Name()
+	}
+	return strings.Join(names, "→")
+}
+
+// Decode applies the decoders of c to data
+func (c Chain) Decode(data []byte) ([]byte, error) {
+	for _, d := range c {
+		var err error
+		if data, err = d.Decode(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", d.Name(), err)
+		}
+	}
+	return data, nil
+}
+
+// Auto decodes data with the decoders sniffing it, until none does. It
+// returns the decoded data and the chain of decoders applied.
+func Auto(data []byte) ([]byte, Chain) {
+	var c Chain
+	for len(c) < maxChain {
+		d := sniff(data)
+		if d == nil {
+			break
+		}
+		out, err := d.Decode(data)
+		if err != nil {
+			break
+		}
+		data = out
+		c = append(c, d)
+	}
+	return data, c
+}
+
+// sniff returns the first decoder sniffing data, or nil
+func sniff(data []byte) Decoder {
+	for _, d := range sniffOrder {
+		if d.Sniff(data) {
+			return d
+		}
+	}
+	return nil
+}
+
+// plausible reports whether data decoded by a decoder without a reliable
+// signature makes sense: it is readable text or is sniffed by another
+// decoder
+func plausible(data []byte) bool {
+	return printable(data) || sniff(data) != nil
+}
+
+// printable reports whether data is non-empty UTF-8 text without control
+// characters other than whitespace
+func printable(data []byte) bool {
+	if len(data) == 0 || !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package decode
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+func gzipped(data []byte) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+func zlibbed(data []byte) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+func TestAuto(t *testing.T) {
+	msgpack := []byte{0x81, 0xa1, 'a', 0x01}
+	tests := []struct {
+		data  []byte
+		out   string
+		chain string
+	}{
+		{[]byte("plain text"), "plain text", ""},
+		{[]byte("password"), "password", ""},
+		{[]byte(`{"a":1}`), `{"a":1}`, ""},
+		{gzipped([]byte("hello world")), "hello world", "gzip"},
+		{zlibbed([]byte("hello world")), "hello world", "zlib"},
+		{snappy.Encode(nil, []byte("hello hello hello world")), "hello hello hello world", "snappy"},
+		{[]byte(base64.StdEncoding.EncodeToString([]byte("hello world"))), "hello world", "base64"},
+		{[]byte(base64.StdEncoding.EncodeToString(gzipped([]byte("hello world")))), "hello world", "base64→gzip"},
+		{msgpack, `{"a":1}`, "msgpack"},
+		{gzipped(msgpack), `{"a":1}`, "gzip→msgpack"},
+	}
+	for _, tt := range tests {
+		out, c := Auto(tt.data)
+		if string(out) != tt.out || c.String() != tt.chain {
+			t.Errorf("Auto(%q) = %q, %q, want %q, %q", tt.data, out, c, tt.out, tt.chain)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	c, err := ParseChain([]string{"base64", "gzip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := c.Decode([]byte(base64.StdEncoding.EncodeToString(gzipped([]byte("x")))))
+	if err != nil || string(out) != "x" {
+		t.Errorf("unexpected result: %q %v", out, err)
+	}
+	if _, err := c.Decode([]byte("not base64!")); err == nil {
+		t.Error("decoding invalid data must fail")
+	}
+	if _, err := ParseChain([]string{"rot13"}); err == nil {
+		t.Error("unknown decoders must fail")
+	}
+}
+
+func TestMsgpack(t *testing.T) {
+	tests := []struct {
+		data []byte
+		out  string
+	}{
+		{[]byte{0x93, 0x01, 0xff, 0xc0}, `[1,-1,null]`},
+		{[]byte{0x82, 0xa1, 'a', 0xc3, 0x01, 0xc2}, `{"a":true,"1":false}`},
+		{[]byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, `1.5`},
+		{[]byte{0xcd, 0x01, 0x00}, `256`},
+		{[]byte{0xd1, 0xff, 0x00}, `-256`},
+		{[]byte{0xd9, 0x02, 'h', 'i'}, `"hi"`},
+		{[]byte{0xc4, 0x02, 0xff, 0xfe}, `"//4="`},
+		{[]byte{0xd4, 0x05, 0x01}, `{"ext":5,"data":"AQ=="}`},
+		{[]byte{0xdc, 0x00, 0x01, 0xa2, '%', 'd'}, `["%d"]`},
+	}
+	d, _ := Get("msgpack")
+	for _, tt := range tests {
+		out, err := d.Decode(tt.data)
+		if err != nil || string(out) != tt.out {
+			t.Errorf("Decode(% x) = %s, %v, want %s", tt.data, out, err, tt.out)
+		}
+	}
+
+	for _, data := range [][]byte{{0x92, 0x01}, {0x01, 0x02}, {0xc1}, {0xd9, 0x05, 'a'}} {
+		if _, err := d.Decode(data); err == nil {
+			t.Errorf("Decode(% x) must fail", data)
+		}
+	}
+	if d.Sniff([]byte{0x01}) {
+		t.Error("msgpack scalars must not be sniffed")
+	}
+}
+
+func TestDecompressLimits(t *testing.T) {
+	// a snappy block claiming to decode to 4 GB
+	huge := []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 0x00}
+	if out, c := Auto(huge); !bytes.Equal(out, huge) || len(c) != 0 {
+		t.Errorf("Auto(%q) = %q, %q, want it undecoded", huge, out, c)
+	}
+	dec, _ := Get("snappy")
+	if _, err := dec.Decode(huge); err == nil {
+		t.Error("decoding an oversized snappy block must fail")
+	}
+
+	bomb := make([]byte, maxDecoded+1)
+	for name, data := range map[string][]byte{"gzip": gzipped(bomb), "zlib": zlibbed(bomb)} {
+		dec, _ := Get(name)
+		if _, err := dec.Decode(data); err != errTooLarge {
+			t.Errorf("%s: expected %v, got %v", name, errTooLarge, err)
+		}
+	}
+	dec, _ = Get("gzip")
+	if data, err := dec.Decode(gzipped(bomb[:maxDecoded])); err != nil || len(data) != maxDecoded {
+		t.Errorf("values up to the limit must decode: %d %v", len(data), err)
+	}
+}
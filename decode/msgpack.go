@@ -0,0 +1,285 @@
+package decode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+func init() {
+	Register(msgpackDecoder{})
+}
+
+var errShort = errors.New("unexpected end of data")
+
+// msgpackDecoder turns msgpack into JSON. Binary data becomes a string
+// when it is UTF-8 and base64 otherwise, extensions become an object with
+// their type and data.
+type msgpackDecoder struct{}
+
+func (msgpackDecoder) Name() string { return "msgpack" }
+
+// Sniff accepts a single map or array, as about anything is valid
+// msgpack when scalars are accepted too
+func (d msgpackDecoder) Sniff(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	b := data[0]
+	if !(b&0xf0 == 0x80 || b&0xf0 == 0x90 || b >= 0xdc && b <= 0xdf) {
+		return false
+	}
+	_, err := d.Decode(data)
+	return err == nil
+}
+
+func (msgpackDecoder) Decode(data []byte) ([]byte, error) {
+	m := &msgpackReader{data: data}
+	var out bytes.Buffer
+	if err := m.value(&out, 0); err != nil {
+		return nil, err
+	}
+	if len(m.data) != 0 {
+		return nil, fmt.Errorf("%d bytes after the value", len(m.data))
+	}
+	return out.Bytes(), nil
+}
+
+// maxDepth limits the nesting of decoded maps and arrays
+const maxDepth = 100
+
+// msgpackReader reads msgpack values from data
+type msgpackReader struct {
+	data []byte
+}
+
+// next returns the next n bytes
+func (m *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || n > len(m.data) {
+		return nil, errShort
+	}
+	b := m.data[:n]
+	m.data = m.data[n:]
+	return b, nil
+}
+
+// readUint reads a big endian unsigned integer of n bytes
+func (m *msgpackReader) readUint(n int) (uint64, error) {
+	b, err := m.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// readInt reads a big endian signed integer of n bytes
+func (m *msgpackReader) readInt(n int) (int64, error) {
+	v, err := m.readUint(n)
+	if err != nil {
+		return 0, err
+	}
+	shift := uint(64 - 8*n)
+	return int64(v<<shift) >> shift, nil
+}
+
+// value writes the next value as JSON to out
+func (m *msgpackReader) value(out *bytes.Buffer, depth int) error {
+	if depth > maxDepth {
+		return errors.New("nested too deep")
+	}
+	b, err := m.next(1)
+	if err != nil {
+		return err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		out.WriteString(strconv.Itoa(int(c)))
+		return nil
+	case c >= 0xe0:
+		out.WriteString(strconv.Itoa(int(int8(c))))
+		return nil
+	case c&0xf0 == 0x80:
+		return m.mapping(out, int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return m.array(out, int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return m.str(out, int(c&0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		out.WriteString("null")
+	case 0xc2:
+		out.WriteString("false")
+	case 0xc3:
+		out.WriteString("true")
+	case 0xc4, 0xc5, 0xc6:
+		n, err := m.readUint(1 << (c - 0xc4))
+		if err != nil {
+			return err
+		}
+		data, err := m.next(int(n))
+		if err != nil {
+			return err
+		}
+		writeBytes(out, data)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := m.readUint(1 << (c - 0xc7))
+		if err != nil {
+			return err
+		}
+		return m.ext(out, int(n))
+	case 0xca:
+		v, err := m.readUint(4)
+		if err != nil {
+			return err
+		}
+		writeFloat(out, float64(math.Float32frombits(uint32(v))), 32)
+	case 0xcb:
+		v, err := m.readUint(8)
+		if err != nil {
+			return err
+		}
+		writeFloat(out, math.Float64frombits(v), 64)
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := m.readUint(1 << (c - 0xcc))
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatUint(v, 10))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		v, err := m.readInt(1 << (c - 0xd0))
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatInt(v, 10))
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return m.ext(out, 1<<(c-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := m.readUint(1 << (c - 0xd9))
+		if err != nil {
+			return err
+		}
+		return m.str(out, int(n))
+	case 0xdc, 0xdd:
+		n, err := m.readUint(2 << (c - 0xdc))
+		if err != nil {
+			return err
+		}
+		return m.array(out, int(n), depth)
+	case 0xde, 0xdf:
+		n, err := m.readUint(2 << (c - 0xde))
+		if err != nil {
+			return err
+		}
+		return m.mapping(out, int(n), depth)
+	default:
+		return fmt.Errorf("invalid msgpack type 0x%02x", c)
+	}
+	return nil
+}
+
+func (m *msgpackReader) str(out *bytes.Buffer, n int) error {
+	data, err := m.next(n)
+	if err != nil {
+		return err
+	}
+	writeString(out, string(data))
+	return nil
+}
+
+func (m *msgpackReader) array(out *bytes.Buffer, n int, depth int) error {
+	out.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		if err := m.value(out, depth+1); err != nil {
+			return err
+		}
+	}
+	out.WriteByte(']')
+	return nil
+}
+
+// mapping writes a map as JSON object, keys that are no strings are
+// written as JSON in a string
+func (m *msgpackReader) mapping(out *bytes.Buffer, n int, depth int) error {
+	out.WriteByte('{')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		var key bytes.Buffer
+		if err := m.value(&key, depth+1); err != nil {
+			return err
+		}
+		if key.Len() > 0 && key.Bytes()[0] == '"' {
+			out.Write(key.Bytes())
+		} else {
+			writeString(out, key.String())
+		}
+		out.WriteByte(':')
+		if err := m.value(out, depth+1); err != nil {
+			return err
+		}
+	}
+	out.WriteByte('}')
+	return nil
+}
+
+// ext writes an extension of n data bytes as object with its type and
+// base64 data
+func (m *msgpackReader) ext(out *bytes.Buffer, n int) error {
+	t, err := m.readInt(1)
+	if err != nil {
+		return err
+	}
+	data, err := m.next(n)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, `{"ext":%d,"data":`, t)
+	writeString(out, base64.StdEncoding.EncodeToString(data))
+	out.WriteByte('}')
+	return nil
+}
+
+// writeString writes s as JSON string
+func writeString(out *bytes.Buffer, s string) {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	// Encode ends with a newline
+	out.Truncate(out.Len() - 1)
+}
+
+// writeBytes writes data as JSON string, base64 encoded when it is not
+// UTF-8
+func writeBytes(out *bytes.Buffer, data []byte) {
+	if utf8.Valid(data) {
+		writeString(out, string(data))
+		return
+	}
+	writeString(out, base64.StdEncoding.EncodeToString(data))
+}
+
+// writeFloat writes f as JSON number, or as string when JSON can't hold it
+func writeFloat(out *bytes.Buffer, f float64, bits int) {
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		writeString(out, s)
+		return
+	}
+	out.WriteString(s)
+}
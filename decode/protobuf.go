@@ -0,0 +1,570 @@
+package decode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register(&protobufDecoder{})
+}
+
+// wire types of protobuf fields
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// protoField is a field of a message as read from the wire, v holds
+// varints and fixed numbers, b length delimited data
+type protoField struct {
+	num  int
+	wire int
+	v    uint64
+	b    []byte
+}
+
+// readVarint reads a varint from data and returns it with the number of
+// bytes read
+func readVarint(data []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < len(data) && i < 10; i++ {
+		v |= uint64(data[i]&0x7f) << (7 * uint(i))
+		if data[i] < 0x80 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errors.New("invalid varint")
+}
+
+// readFields calls fn for every field of the protobuf message in data
+func readFields(data []byte, fn func(f protoField) error) error {
+	for len(data) > 0 {
+		tag, n, err := readVarint(data)
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+		f := protoField{num: int(tag >> 3), wire: int(tag & 7)}
+		if f.num <= 0 || tag>>3 > math.MaxInt32 {
+			return fmt.Errorf("invalid field number %d", tag>>3)
+		}
+		switch f.wire {
+		case wireVarint:
+			if f.v, n, err = readVarint(data); err != nil {
+				return err
+			}
+		case wireFixed64, wireFixed32:
+			n = 8
+			if f.wire == wireFixed32 {
+				n = 4
+			}
+			if len(data) < n {
+				return errShort
+			}
+			for i := n - 1; i >= 0; i-- {
+				f.v = f.v<<8 | uint64(data[i])
+			}
+		case wireBytes:
+			var l uint64
+			if l, n, err = readVarint(data); err != nil {
+				return err
+			}
+			if l > uint64(len(data)-n) {
+				return errShort
+			}
+			f.b = data[n : n+int(l)]
+			n += int(l)
+		default:
+			return fmt.Errorf("unsupported wire type %d", f.wire)
+		}
+		data = data[n:]
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// field types of a protobuf schema, as in descriptor.proto
+const (
+	typeDouble   = 1
+	typeFloat    = 2
+	typeInt64    = 3
+	typeUint64   = 4
+	typeInt32    = 5
+	typeFixed64  = 6
+	typeFixed32  = 7
+	typeBool     = 8
+	typeString   = 9
+	typeMessage  = 11
+	typeBytes    = 12
+	typeUint32   = 13
+	typeEnum     = 14
+	typeSfixed32 = 15
+	typeSfixed64 = 16
+	typeSint32   = 17
+	typeSint64   = 18
+
+	labelRepeated = 3
+)
+
+// protoMessage is a message type of a protobuf schema
+type protoMessage struct {
+	name     string
+	fields   map[int]*fieldDesc
+	mapEntry bool
+}
+
+// fieldDesc is a field of a message type
+type fieldDesc struct {
+	name     string
+	label    int
+	typ      int
+	typeName string
+}
+
+// Descriptors holds the message and enum types of a protobuf descriptor
+// set, as written by protoc --descriptor_set_out
+type Descriptors struct {
+	messages map[string]*protoMessage
+	// enums maps enum types to the names of their values
+	enums map[string]map[int32]string
+}
+
+// LoadDescriptors reads a protobuf descriptor set from the file at path
+func LoadDescriptors(path string) (*Descriptors, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDescriptors(data)
+}
+
+// ParseDescriptors parses a serialized FileDescriptorSet
+func ParseDescriptors(data []byte) (*Descriptors, error) {
+	d := &Descriptors{messages: make(map[string]*protoMessage), enums: make(map[string]map[int32]string)}
+	err := readFields(data, func(f protoField) error {
+		if f.num != 1 || f.wire != wireBytes {
+			return nil
+		}
+		// a FileDescriptorProto
+		var pkg string
+		var messages, enums [][]byte
+		err := readFields(f.b, func(f protoField) error {
+			switch {
+			case f.wire != wireBytes:
+			case f.num == 2:
+				pkg = string(f.b)
+			case f.num == 4:
+				messages = append(messages, f.b)
+			case f.num == 5:
+				enums = append(enums, f.b)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, m := range messages {
+			if err := d.addMessage(pkg, m); err != nil {
+				return err
+			}
+		}
+		for _, e := range enums {
+			if err := d.addEnum(pkg, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %v", err)
+	}
+	return d, nil
+}
+
+// qualify returns the full name of name in scope
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// addMessage adds the DescriptorProto in data and its nested types
+func (d *Descriptors) addMessage(scope string, data []byte) error {
+	m := &protoMessage{fields: make(map[int]*fieldDesc)}
+	var nested, enums [][]byte
+	err := readFields(data, func(f protoField) error {
+		switch {
+		case f.num == 1 && f.wire == wireBytes:
+			m.name = string(f.b)
+		case f.num == 2 && f.wire == wireBytes:
+			return m.addField(f.b)
+		case f.num == 3 && f.wire == wireBytes:
+			nested = append(nested, f.b)
+		case f.num == 4 && f.wire == wireBytes:
+			enums = append(enums, f.b)
+		case f.num == 7 && f.wire == wireBytes:
+			// MessageOptions
+			return readFields(f.b, func(f protoField) error {
+				if f.num == 7 && f.wire == wireVarint {
+					m.mapEntry = f.v != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	m.name = qualify(scope, m.name)
+	d.messages[m.name] = m
+	for _, n := range nested {
+		if err := d.addMessage(m.name, n); err != nil {
+			return err
+		}
+	}
+	for _, e := range enums {
+		if err := d.addEnum(m.name, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addField adds the FieldDescriptorProto in data to m
+func (m *protoMessage) addField(data []byte) error {
+	fd := &fieldDesc{}
+	var num int
+	err := readFields(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			fd.name = string(f.b)
+		case 3:
+			num = int(int32(f.v))
+		case 4:
+			fd.label = int(f.v)
+		case 5:
+			fd.typ = int(f.v)
+		case 6:
+			fd.typeName = strings.TrimPrefix(string(f.b), ".")
+		}
+		return nil
+	})
+	m.fields[num] = fd
+	return err
+}
+
+// addEnum adds the EnumDescriptorProto in data
+func (d *Descriptors) addEnum(scope string, data []byte) error {
+	var name string
+	values := make(map[int32]string)
+	err := readFields(data, func(f protoField) error {
+		switch {
+		case f.num == 1 && f.wire == wireBytes:
+			name = string(f.b)
+		case f.num == 2 && f.wire == wireBytes:
+			var vname string
+			var num int32
+			err := readFields(f.b, func(f protoField) error {
+				switch f.num {
+				case 1:
+					vname = string(f.b)
+				case 2:
+					num = int32(f.v)
+				}
+				return nil
+			})
+			values[num] = vname
+			return err
+		}
+		return nil
+	})
+	d.enums[qualify(scope, name)] = values
+	return err
+}
+
+// Messages returns the sorted names of the message types
+func (d *Descriptors) Messages() []string {
+	var names []string
+	for name, m := range d.messages {
+		if !m.mapEntry {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Decoder returns a decoder for the message type with the given full
+// name, like "pkg.Message"
+func (d *Descriptors) Decoder(message string) (Decoder, error) {
+	m, ok := d.messages[message]
+	if !ok {
+		return nil, fmt.Errorf("unknown protobuf message: %s", message)
+	}
+	return &protobufDecoder{desc: d, msg: m}, nil
+}
+
+// protobufDecoder turns protobuf messages into JSON. Without a message type
+// fields are named by their number and length delimited fields are
+// shown as string, nested message or base64, whichever fits.
+type protobufDecoder struct {
+	desc *Descriptors
+	msg  *protoMessage
+}
+
+func (p *protobufDecoder) Name() string {
+	if p.msg != nil {
+		return "protobuf:" + p.msg.name
+	}
+	return "protobuf"
+}
+
+// Sniff never matches, protobuf has no signature
+func (p *protobufDecoder) Sniff(data []byte) bool {
+	return false
+}
+
+func (p *protobufDecoder) Decode(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	if err := p.message(&out, data, p.msg, 0); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// message writes the message in data of type m as JSON object, m is nil
+// when the type is unknown
+func (p *protobufDecoder) message(out *bytes.Buffer, data []byte, m *protoMessage, depth int) error {
+	if depth > maxDepth {
+		return errors.New("nested too deep")
+	}
+	// the values of each field in the order the fields first appear
+	var order []int
+	values := make(map[int][]string)
+	err := readFields(data, func(f protoField) error {
+		var fd *fieldDesc
+		if m != nil {
+			fd = m.fields[f.num]
+		}
+		vals, err := p.value(f, fd, depth)
+		if err != nil {
+			return fmt.Errorf("field %d: %v", f.num, err)
+		}
+		if len(vals) == 0 {
+			// an empty packed field holds no values
+			return nil
+		}
+		if _, seen := values[f.num]; !seen {
+			order = append(order, f.num)
+		}
+		if fd == nil || fd.label == labelRepeated {
+			values[f.num] = append(values[f.num], vals...)
+		} else {
+			// the last value of a singular field wins
+			values[f.num] = vals
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	out.WriteByte('{')
+	for i, num := range order {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		var fd *fieldDesc
+		if m != nil {
+			fd = m.fields[num]
+		}
+		vals := values[num]
+		if fd == nil {
+			// unknown fields appear once per value
+			for j, v := range vals {
+				if j > 0 {
+					out.WriteByte(',')
+				}
+				fmt.Fprintf(out, `"%d":%s`, num, v)
+			}
+			continue
+		}
+		writeString(out, fd.name)
+		out.WriteByte(':')
+		switch {
+		case fd.label != labelRepeated:
+			out.WriteString(vals[len(vals)-1])
+		case p.isMap(fd):
+			out.WriteByte('{')
+			for j, v := range vals {
+				if j > 0 {
+					out.WriteByte(',')
+				}
+				out.WriteString(v)
+			}
+			out.WriteByte('}')
+		default:
+			out.WriteByte('[')
+			out.WriteString(strings.Join(vals, ","))
+			out.WriteByte(']')
+		}
+	}
+	out.WriteByte('}')
+	return nil
+}
+
+// isMap reports whether fd is a map field
+func (p *protobufDecoder) isMap(fd *fieldDesc) bool {
+	if fd.typ != typeMessage {
+		return false
+	}
+	m, ok := p.desc.messages[fd.typeName]
+	return ok && m.mapEntry
+}
+
+// value returns the JSON of the values in f, packed repeated fields hold
+// multiple. Map entries are returned as "key":value.
+func (p *protobufDecoder) value(f protoField, fd *fieldDesc, depth int) ([]string, error) {
+	var out bytes.Buffer
+	if fd == nil {
+		if f.wire != wireBytes {
+			return []string{strconv.FormatUint(f.v, 10)}, nil
+		}
+		if len(f.b) == 0 || printable(f.b) {
+			writeString(&out, string(f.b))
+		} else if err := p.message(&out, f.b, nil, depth+1); err != nil {
+			out.Reset()
+			writeBytes(&out, f.b)
+		}
+		return []string{out.String()}, nil
+	}
+
+	switch fd.typ {
+	case typeString, typeBytes:
+		if f.wire != wireBytes {
+			return nil, fmt.Errorf("wire type %d for %s", f.wire, fd.name)
+		}
+		writeBytes(&out, f.b)
+		return []string{out.String()}, nil
+	case typeMessage:
+		if f.wire != wireBytes {
+			return nil, fmt.Errorf("wire type %d for %s", f.wire, fd.name)
+		}
+		m := p.desc.messages[fd.typeName]
+		if m != nil && m.mapEntry {
+			return p.mapEntry(f.b, m, depth)
+		}
+		if err := p.message(&out, f.b, m, depth+1); err != nil {
+			return nil, err
+		}
+		return []string{out.String()}, nil
+	}
+
+	if f.wire != wireBytes {
+		return []string{p.scalar(f.v, fd)}, nil
+	}
+	// packed repeated scalars
+	var vals []string
+	data := f.b
+	for len(data) > 0 {
+		var v uint64
+		switch fd.typ {
+		case typeDouble, typeFixed64, typeSfixed64:
+			if len(data) < 8 {
+				return nil, errShort
+			}
+			for i := 7; i >= 0; i-- {
+				v = v<<8 | uint64(data[i])
+			}
+			data = data[8:]
+		case typeFloat, typeFixed32, typeSfixed32:
+			if len(data) < 4 {
+				return nil, errShort
+			}
+			for i := 3; i >= 0; i-- {
+				v = v<<8 | uint64(data[i])
+			}
+			data = data[4:]
+		default:
+			var n int
+			var err error
+			if v, n, err = readVarint(data); err != nil {
+				return nil, err
+			}
+			data = data[n:]
+		}
+		vals = append(vals, p.scalar(v, fd))
+	}
+	return vals, nil
+}
+
+// mapEntry returns a map entry as "key":value
+func (p *protobufDecoder) mapEntry(data []byte, m *protoMessage, depth int) ([]string, error) {
+	key, value := `""`, "null"
+	err := readFields(data, func(f protoField) error {
+		fd := m.fields[f.num]
+		if fd == nil || f.num > 2 {
+			return nil
+		}
+		vals, err := p.value(f, fd, depth)
+		if err != nil || len(vals) == 0 {
+			return err
+		}
+		if f.num == 1 {
+			key = vals[0]
+		} else {
+			value = vals[0]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(key, `"`) {
+		var k bytes.Buffer
+		writeString(&k, key)
+		key = k.String()
+	}
+	return []string{key + ":" + value}, nil
+}
+
+// scalar returns the JSON of the number v for a field of type fd
+func (p *protobufDecoder) scalar(v uint64, fd *fieldDesc) string {
+	var out bytes.Buffer
+	switch fd.typ {
+	case typeDouble:
+		writeFloat(&out, math.Float64frombits(v), 64)
+		return out.String()
+	case typeFloat:
+		writeFloat(&out, float64(math.Float32frombits(uint32(v))), 32)
+		return out.String()
+	case typeBool:
+		return strconv.FormatBool(v != 0)
+	case typeInt32, typeSfixed32:
+		return strconv.FormatInt(int64(int32(v)), 10)
+	case typeInt64, typeSfixed64:
+		return strconv.FormatInt(int64(v), 10)
+	case typeSint32, typeSint64:
+		return strconv.FormatInt(int64(v>>1)^-int64(v&1), 10)
+	case typeEnum:
+		if name, ok := p.desc.enums[fd.typeName][int32(v)]; ok {
+			writeString(&out, name)
+			return out.String()
+		}
+		return strconv.FormatInt(int64(int32(v)), 10)
+	}
+	return strconv.FormatUint(v, 10)
+}
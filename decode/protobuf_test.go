@@ -0,0 +1,125 @@
+package decode
+
+import (
+	"testing"
+)
+
+// pb encodes fields as protobuf message, values are varints when they are
+// ints and length delimited when they are strings or byte slices
+func pb(fields ...interface{}) []byte {
+	var out []byte
+	varint := func(v uint64) {
+		for v >= 0x80 {
+			out = append(out, byte(v)|0x80)
+			v >>= 7
+		}
+		out = append(out, byte(v))
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		num := uint64(fields[i].(int))
+		switch v := fields[i+1].(type) {
+		case int:
+			varint(num << 3)
+			varint(uint64(v))
+		case string:
+			varint(num<<3 | wireBytes)
+			varint(uint64(len(v)))
+			out = append(out, v...)
+		case []byte:
+			varint(num<<3 | wireBytes)
+			varint(uint64(len(v)))
+			out = append(out, v...)
+		}
+	}
+	return out
+}
+
+// field returns a FieldDescriptorProto
+func field(name string, num, label, typ int, typeName string) []byte {
+	f := pb(1, name, 3, num, 4, label, 5, typ)
+	if typeName != "" {
+		f = append(f, pb(6, typeName)...)
+	}
+	return f
+}
+
+func testDescriptors(t *testing.T) *Descriptors {
+	entry := pb(1, "TagsEntry",
+		2, field("key", 1, 1, typeString, ""),
+		2, field("value", 2, 1, typeInt32, ""),
+		7, pb(7, 1))
+	user := pb(1, "User",
+		2, field("name", 1, 1, typeString, ""),
+		2, field("ids", 2, labelRepeated, typeInt64, ""),
+		2, field("role", 3, 1, typeEnum, ".app.Role"),
+		2, field("tags", 4, labelRepeated, typeMessage, ".app.User.TagsEntry"),
+		2, field("friend", 5, 1, typeMessage, ".app.User"),
+		2, field("delta", 6, 1, typeSint32, ""),
+		3, entry)
+	role := pb(1, "Role", 2, pb(1, "GUEST", 2, 0), 2, pb(1, "ADMIN", 2, 1))
+	file := pb(1, "app.proto", 2, "app", 4, user, 5, role)
+	d, err := ParseDescriptors(pb(1, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestProtobuf(t *testing.T) {
+	d := testDescriptors(t)
+	if names := d.Messages(); len(names) != 1 || names[0] != "app.User" {
+		t.Errorf("unexpected messages: %v", names)
+	}
+	dec, err := d.Decoder("app.User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec.Name() != "protobuf:app.User" {
+		t.Errorf("unexpected name: %s", dec.Name())
+	}
+
+	msg := pb(1, "rik",
+		2, 7, 2, 8,
+		3, 1,
+		4, pb(1, "a", 2, 1),
+		4, pb(1, "b", 2, 2),
+		5, pb(1, "bats", 3, 5),
+		6, 3,
+		9, 42)
+	out, err := dec.Decode(msg)
+	want := `{"name":"rik","ids":[7,8],"role":"ADMIN","tags":{"a":1,"b":2},"friend":{"name":"bats","role":5},"delta":-2,"9":42}`
+	if err != nil || string(out) != want {
+		t.Errorf("Decode = %s, %v, want %s", out, err, want)
+	}
+
+	// packed repeated field
+	out, err = dec.Decode(pb(2, []byte{1, 2, 0x80, 0x01}))
+	if err != nil || string(out) != `{"ids":[1,2,128]}` {
+		t.Errorf("unexpected packed result: %s %v", out, err)
+	}
+
+	// empty packed payload of a singular field
+	out, err = dec.Decode([]byte{0x32, 0x00})
+	if err != nil || string(out) != `{}` {
+		t.Errorf("unexpected result of an empty field: %s %v", out, err)
+	}
+
+	if _, err := d.Decoder("app.Missing"); err == nil {
+		t.Error("unknown messages must fail")
+	}
+}
+
+func TestProtobufRaw(t *testing.T) {
+	dec, _ := Get("protobuf")
+	out, err := dec.Decode(pb(1, "name", 2, 150, 3, pb(1, 1), 3, []byte{0xff}))
+	want := `{"1":"name","2":150,"3":{"1":1},"3":"/w=="}`
+	if err != nil || string(out) != want {
+		t.Errorf("Decode = %s, %v, want %s", out, err, want)
+	}
+	if _, err := dec.Decode([]byte{0x0a, 0x05, 'a'}); err == nil {
+		t.Error("truncated messages must fail")
+	}
+	if dec.Sniff(pb(1, 1)) {
+		t.Error("protobuf must not be sniffed")
+	}
+}
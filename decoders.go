@@ -0,0 +1,169 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jroimartin/gocui"
+	"github.com/rikvdh/kvui/decode"
+	"github.com/rikvdh/kvui/kv/glob"
+	"github.com/rikvdh/kvui/kv/types"
+)
+
+// decoding is a way to decode values for display
+type decoding struct {
+	name string
+	// auto decodes with the decoders sniffing the value
+	auto  bool
+	chain decode.Chain
+}
+
+var (
+	// decoderRules select the decoding of values by key pattern
+	decoderRules []decoderRule
+	// decoderChains holds the parsed chains of decoderRules
+	decoderChains []decode.Chain
+	// extraDecoders are the decoders of the protobuf messages in the
+	// descriptor set of the config
+	extraDecoders []decode.Decoder
+	// decodeMode holds the index in decodings of keys for which another
+	// decoding was selected
+	decodeMode = make(map[string]int)
+)
+
+// setupDecoders loads the decoder rules and protobuf descriptors of cfg
+func setupDecoders(cfg *config) error {
+	var desc *decode.Descriptors
+	if cfg.Protobuf != "" {
+		var err error
+		if desc, err = decode.LoadDescriptors(expandHome(cfg.Protobuf)); err != nil {
+			return err
+		}
+		for _, m := range desc.Messages() {
+			d, _ := desc.Decoder(m)
+			extraDecoders = append(extraDecoders, d)
+		}
+	}
+	for _, r := range cfg.Decoders {
+		var c decode.Chain
+		for _, name := range r.Chain {
+			d, err := decoderByName(name, desc)
+			if err != nil {
+				return fmt.Errorf("decoders for %s: %v", r.Keys, err)
+			}
+			c = append(c, d)
+		}
+		decoderRules = append(decoderRules, r)
+		decoderChains = append(decoderChains, c)
+	}
+	return nil
+}
+
+// decoderByName returns the registered decoder with the given name, or the
+// decoder of a protobuf message for protobuf:pkg.Message
+func decoderByName(name string, desc *decode.Descriptors) (decode.Decoder, error) {
+	if !strings.HasPrefix(name, "protobuf:") {
+		return decode.Get(name)
+	}
+	if desc == nil {
+		return nil, fmt.Errorf("%s needs a protobuf descriptor set in the config", name)
+	}
+	return desc.Decoder(strings.TrimPrefix(name, "protobuf:"))
+}
+
+// decodings returns the ways to decode the values of key, the first is
+// the one of the first matching rule or else auto
+func decodings(key string) []decoding {
+	d := []decoding{{name: "auto", auto: true}}
+	for i, r := range decoderRules {
+		if glob.Match(r.Keys, key) {
+			d[0] = decoding{name: decoderChains[i].String(), chain: decoderChains[i]}
+			break
+		}
+	}
+	d = append(d, decoding{name: "none"})
+	for _, name := range decode.Names() {
+		dec, _ := decode.Get(name)
+		d = append(d, decoding{name: name, chain: decode.Chain{dec}})
+	}
+	for _, dec := range extraDecoders {
+		d = append(d, decoding{name: dec.Name(), chain: decode.Chain{dec}})
+	}
+	return d
+}
+
+// decodingOf returns the selected decoding of the values of key
+func decodingOf(key string) decoding {
+	d := decodings(key)
+	return d[decodeMode[key]%len(d)]
+}
+
+// decoded is a value decoded for display
+type decoded struct {
+	str string
+	// chain names the applied decoders, it is empty when auto decoding
+	// found none
+	chain string
+	// binary is set when str is no text, it is shown as hex dump
+	binary bool
+	// json is str parsed, when it is JSON
+	json *jsonNode
+	err  error
+}
+
+// decodeValue decodes value for display with d
+func decodeValue(d decoding, value []byte) decoded {
+	if d.auto {
+		out, c := decode.Auto(value)
+		return newDecoded(out, c.String())
+	}
+	if len(d.chain) == 0 {
+		return newDecoded(value, d.name)
+	}
+	out, err := d.chain.Decode(value)
+	if err != nil {
+		dec := newDecoded(value, "")
+		dec.err = err
+		return dec
+	}
+	return newDecoded(out, d.name)
+}
+
+// newDecoded returns the decoded value data, the result of chain
+func newDecoded(data []byte, chain string) decoded {
+	dec := decoded{str: string(data), chain: chain, binary: isBinary(data)}
+	if !dec.binary {
+		dec.json = parseJSON(dec.str)
+	}
+	return dec
+}
+
+// cycleDecoder selects the next decoding for the values of the selected
+// key
+func cycleDecoder(g *gocui.Gui, v *gocui.View) error {
+	val := currentValue
+	if val == nil || (val.t != types.KVTypeString && val.t != types.KVTypeMap) {
+		return nil
+	}
+	decodeMode[val.key]++
+	d := decodingOf(val.key)
+	if val.t == types.KVTypeString {
+		val.shown = decodeValue(d, val.data)
+		if val.shown.err != nil {
+			showError(g, val.shown.err)
+		}
+		return redrawView(g, valueView)
+	}
+	if subValue != nil {
+		subValue.shown = decodeValue(d, subValue.data)
+		if subValue.shown.err != nil {
+			showError(g, subValue.shown.err)
+		}
+	}
+	redrawView(g, valueView)
+	return redrawView(g, subValueView)
+}
@@ -0,0 +1,196 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jroimartin/gocui"
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/types"
+)
+
+// undoSize is the number of deletions that can be undone
+const undoSize = 16
+
+// undoBuffer holds the deleted keys and fields, the last deletion last
+var undoBuffer []*deletion
+
+// deletion is a deleted key or map field, with what is needed to restore it
+type deletion struct {
+	db    int
+	key   string
+	field string
+	hash  bool
+	// value is the value of the deleted field
+	value []byte
+	// dump is the dumped value of the deleted key, ttl the expiration of
+	// the key, also of the hash a field was deleted from
+	dump []byte
+	ttl  time.Duration
+	// deleted is when the deletion was done
+	deleted time.Time
+}
+
+func (d *deletion) String() string {
+	if d.hash {
+		return d.key + " " + d.field
+	}
+	return d.key
+}
+
+// del dumps the key or field and removes it from the KV-store
+func (d *deletion) del(ctx context.Context, store kv.KV) error {
+	var err error
+	if d.hash {
+		if d.value, err = store.HGet(ctx, d.key, d.field); err != nil {
+			return err
+		}
+		// the hash is gone with its last field, the TTL is needed to
+		// create it again
+		if d.ttl, err = store.TTL(ctx, d.key); err != nil && err != kv.ErrNotSupported {
+			return err
+		}
+		return store.HDel(ctx, d.key, d.field)
+	}
+	dumper, ok := store.(kv.Dumper)
+	if !ok {
+		// the key can't be restored, it is deleted without undo
+		return store.Del(ctx, d.key)
+	}
+	if d.dump, err = dumper.Dump(ctx, d.key); err != nil {
+		return err
+	}
+	if d.ttl, err = store.TTL(ctx, d.key); err != nil && err != kv.ErrNotSupported {
+		return err
+	}
+	return store.Del(ctx, d.key)
+}
+
+// restore puts the key or field back in database db of the KV-store, cur
+// is the database selected again afterwards
+func (d *deletion) restore(ctx context.Context, store kv.KV, cur int) error {
+	if d.db != cur {
+		if err := store.Database(ctx, d.db); err != nil {
+			return err
+		}
+		defer store.Database(ctx, cur)
+	}
+	ttl := d.ttl
+	if ttl > 0 {
+		// the key would have expired by now anyway
+		if ttl -= time.Since(d.deleted); ttl <= 0 {
+			return fmt.Errorf("key %s expired since it was deleted", d.key)
+		}
+	}
+	if d.hash {
+		if err := store.HSet(ctx, d.key, d.field, d.value); err != nil {
+			return err
+		}
+		// a hash created again by HSet has no expiration
+		if ttl > 0 {
+			if cur, err := store.TTL(ctx, d.key); err == nil && cur < 0 {
+				return store.Expire(ctx, d.key, ttl)
+			}
+		}
+		return nil
+	}
+	// undoable deletions of keys are only made on a kv.Dumper
+	return store.(kv.Dumper).Restore(ctx, d.key, ttl, d.dump)
+}
+
+// undoable reports whether the deletion can be undone
+func (d *deletion) undoable() bool {
+	return d.hash || d.dump != nil
+}
+
+// deleteValue asks to delete the field under the cursor when the map value
+// view is focused, or else the selected key
+func deleteValue(g *gocui.Gui, v *gocui.View) error {
+	if !writable(g) {
+		return nil
+	}
+	if currentKey == "" {
+		return nil
+	}
+	d := &deletion{db: currentDb, key: currentKey}
+	if v.Name() == valueView {
+		if currentValue == nil || currentValue.t != types.KVTypeMap || currentField == "" {
+			return nil
+		}
+		d.field, d.hash = currentField, true
+	}
+	return confirm(g, "Delete "+printable(d.String())+"?", func(g *gocui.Gui) error {
+		kvfetch.fetch("", func(ctx context.Context, store kv.KV) (interface{}, error) {
+			return nil, d.del(ctx, store)
+		}, func(g *gocui.Gui, res interface{}, err error) error {
+			if err != nil {
+				showError(g, err)
+				return nil
+			}
+			d.deleted = time.Now()
+			if d.undoable() {
+				if undoBuffer = append(undoBuffer, d); len(undoBuffer) > undoSize {
+					undoBuffer = undoBuffer[1:]
+				}
+			}
+			if d.db != currentDb {
+				return nil
+			}
+			if d.hash {
+				if d.key == currentKey {
+					loadValue(g)
+				}
+				return nil
+			}
+			treeRoot.remove(d.key)
+			delete(expiries, d.key)
+			return redrawView(g, treeView)
+		})
+		return nil
+	})
+}
+
+// undoDelete restores the last deletion in the undo buffer
+func undoDelete(g *gocui.Gui, v *gocui.View) error {
+	if !writable(g) {
+		return nil
+	}
+	if len(undoBuffer) == 0 {
+		return nil
+	}
+	d := undoBuffer[len(undoBuffer)-1]
+	undoBuffer = undoBuffer[:len(undoBuffer)-1]
+	cur := currentDb
+	kvfetch.fetch("", func(ctx context.Context, store kv.KV) (interface{}, error) {
+		return nil, d.restore(ctx, store, cur)
+	}, func(g *gocui.Gui, res interface{}, err error) error {
+		if err != nil {
+			// keep it, so the undo can be tried again
+			undoBuffer = append(undoBuffer, d)
+			showError(g, err)
+			return nil
+		}
+		if d.db != currentDb {
+			return nil
+		}
+		if d.hash {
+			if d.key == currentKey {
+				loadValue(g)
+			}
+			return nil
+		}
+		if treeFilter.match(d.key) {
+			treeRoot.insert(d.key)
+		}
+		if d.ttl > 0 {
+			setExpiry(d.key, d.ttl-time.Since(d.deleted))
+		}
+		return selectKey(g, d.key)
+	})
+	return nil
+}
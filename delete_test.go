@@ -0,0 +1,39 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rikvdh/kvui/kv/ramkv"
+)
+
+func TestUndoLastField(t *testing.T) {
+	ctx := context.Background()
+	store, _ := ramkv.New()
+	store.HSet(ctx, "session", "user", "rik")
+	store.Expire(ctx, "session", time.Hour)
+
+	d := &deletion{key: "session", field: "user", hash: true}
+	if err := d.del(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	d.deleted = time.Now()
+	if _, err := store.Type(ctx, "session"); err == nil {
+		t.Fatal("the hash must be gone with its last field")
+	}
+
+	if err := d.restore(ctx, store, 0); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := store.HGet(ctx, "session", "user"); err != nil || string(value) != "rik" {
+		t.Errorf("field not restored: %q %v", value, err)
+	}
+	if ttl, err := store.TTL(ctx, "session"); err != nil || ttl <= 59*time.Minute {
+		t.Errorf("the TTL of the hash must be restored: %s %v", ttl, err)
+	}
+}
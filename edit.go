@@ -0,0 +1,141 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jroimartin/gocui"
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/types"
+)
+
+const editView = "edit"
+
+// editTarget is the key, or field of a map, being edited
+var editTarget *editing
+
+// editing describes the value opened in the edit view
+type editing struct {
+	key   string
+	field string
+	hash  bool
+}
+
+func (e *editing) String() string {
+	if e.hash {
+		return e.key + " " + e.field
+	}
+	return e.key
+}
+
+// editValue opens the value of currentKey, or of currentField when it is a
+// map, in the edit view
+func editValue(g *gocui.Gui, v *gocui.View) error {
+	if !writable(g) {
+		return nil
+	}
+	if currentValue == nil {
+		return nil
+	}
+	var value []byte
+	switch currentValue.t {
+	case types.KVTypeString:
+		editTarget = &editing{key: currentValue.key}
+		value = currentValue.data
+	case types.KVTypeMap:
+		if currentField == "" || subValue == nil {
+			return nil
+		}
+		editTarget = &editing{key: currentValue.key, field: currentField, hash: true}
+		value = subValue.data
+	default:
+		showError(g, fmt.Errorf("editing %s values is not supported", currentValue.t))
+		return nil
+	}
+	if isBinary(value) {
+		editTarget = nil
+		showError(g, fmt.Errorf("editing binary values is not supported"))
+		return nil
+	}
+
+	sizeX, sizeY := g.Size()
+	ev, err := g.SetView(editView, treeSize+1, viewTop(), sizeX-1, sizeY-4)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	ev.Title = "edit " + printable(editTarget.String()) + " (ctrl-s saves, esc cancels)"
+	ev.Editable = true
+	ev.Wrap = false
+	ev.Clear()
+	ev.Write(value)
+	ev.SetOrigin(0, 0)
+	ev.SetCursor(0, 0)
+	_, err = g.SetCurrentView(editView)
+	return err
+}
+
+// closeEdit removes the edit view and gives the focus back to currentView
+func closeEdit(g *gocui.Gui) error {
+	editTarget = nil
+	if err := g.DeleteView(editView); err != nil {
+		return err
+	}
+	_, err := g.SetCurrentView(currentView)
+	return err
+}
+
+// editSave writes the edited value to the KV-store after confirmation, the
+// edit view stays open when writing fails
+func editSave(g *gocui.Gui, v *gocui.View) error {
+	target := editTarget
+	if target == nil {
+		return nil
+	}
+	value := strings.TrimSuffix(v.Buffer(), "\n")
+	return confirm(g, "Save "+printable(target.String())+"?", func(g *gocui.Gui) error {
+		kvfetch.fetch("", func(ctx context.Context, store kv.KV) (interface{}, error) {
+			if target.hash {
+				return nil, store.HSet(ctx, target.key, target.field, value)
+			}
+			return nil, setValue(ctx, store, target.key, value)
+		}, func(g *gocui.Gui, res interface{}, err error) error {
+			if err != nil {
+				showError(g, err)
+				return nil
+			}
+			if editTarget == target {
+				if err := closeEdit(g); err != nil {
+					return err
+				}
+			}
+			if target.key == currentKey {
+				loadValue(g)
+			}
+			return nil
+		})
+		return nil
+	})
+}
+
+// setValue stores value at key and keeps the expiration of key, which is
+// removed by setting a value
+func setValue(ctx context.Context, store kv.KV, key, value string) error {
+	// a key without expiration, or a store without TTLs, gets none
+	ttl, terr := store.TTL(ctx, key)
+	if err := store.Set(ctx, key, value); err != nil {
+		return err
+	}
+	if terr == nil && ttl > 0 {
+		return store.Expire(ctx, key, ttl)
+	}
+	return nil
+}
+
+func editCancel(g *gocui.Gui, v *gocui.View) error {
+	return closeEdit(g)
+}
@@ -0,0 +1,36 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rikvdh/kvui/kv/ramkv"
+)
+
+func TestSetValueKeepsTTL(t *testing.T) {
+	ctx := context.Background()
+	store, _ := ramkv.New()
+	store.Set(ctx, "session", "old")
+	store.Expire(ctx, "session", time.Hour)
+	store.Set(ctx, "config", "old")
+
+	for _, key := range []string{"session", "config"} {
+		if err := setValue(ctx, store, key, "new"); err != nil {
+			t.Fatal(err)
+		}
+		if value, _ := store.Get(ctx, key); string(value) != "new" {
+			t.Errorf("value of %s = %q, want new", key, value)
+		}
+	}
+	if ttl, err := store.TTL(ctx, "session"); err != nil || ttl <= 59*time.Minute {
+		t.Errorf("the TTL of an edited key must be kept: %s %v", ttl, err)
+	}
+	if ttl, err := store.TTL(ctx, "config"); err != nil || ttl >= 0 {
+		t.Errorf("an edited key without TTL must not get one: %s %v", ttl, err)
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/jroimartin/gocui"
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/types"
+)
+
+// elements is a window on the elements of a list, map, set or sorted set.
+// Only the elements around the visible ones are fetched: lists and sorted
+// sets by index, maps and sets are scanned up to the visible elements.
+type elements struct {
+	// total is the number of elements of the key
+	total int
+	// offset is the index of the first fetched element
+	offset  int
+	items   []string
+	members []kv.Z
+	// cursor continues the scan of a map or set, scanned is set when the
+	// scan is complete. seen holds the scanned elements, a scan can return
+	// an element more than once.
+	cursor  uint64
+	scanned bool
+	seen    map[string]bool
+	// memberOrder is set when the members of a sorted set are sorted by
+	// member, they are all fetched at once then
+	memberOrder bool
+	loading     bool
+	// loadErr stops fetching more elements after a failure
+	loadErr error
+	// top is the index of the element at the top of the value view, sel
+	// the index of the selected element
+	top int
+	sel int
+}
+
+// elementPage is a page of elements as fetched from the KV-store
+type elementPage struct {
+	offset  int
+	items   []string
+	members []kv.Z
+	cursor  uint64
+	scanned bool
+}
+
+// paged reports whether values of type t are shown a window at a time
+func paged(t types.KVType) bool {
+	switch t {
+	case types.KVTypeList, types.KVTypeMap, types.KVTypeSet, types.KVTypeSortedSet:
+		return true
+	}
+	return false
+}
+
+// indexed reports whether elements of type t are fetched by index, the
+// others are scanned
+func indexed(t types.KVType) bool {
+	return t == types.KVTypeList || t == types.KVTypeSortedSet
+}
+
+// lookAhead is the number of elements fetched beyond the visible ones
+func lookAhead() int {
+	if *pageSize < 2 {
+		return 1
+	}
+	return *pageSize / 2
+}
+
+// fetchElements fetches count elements of key starting at offset for
+// lists and sorted sets, or the scan page at cursor for maps and sets
+func fetchElements(ctx context.Context, store kv.KV, key string, t types.KVType, offset int, cursor uint64, count int) (*elementPage, error) {
+	page := &elementPage{offset: offset}
+	var err error
+	switch t {
+	case types.KVTypeList:
+		page.items, err = store.LRange(ctx, key, offset, count)
+	case types.KVTypeSortedSet:
+		page.members, err = store.ZRangeWithScores(ctx, key, offset, offset+count-1)
+	case types.KVTypeMap:
+		page.cursor, page.items, err = store.HScan(ctx, key, cursor, "*", count)
+		page.scanned = page.cursor == 0
+	case types.KVTypeSet:
+		page.cursor, page.items, err = store.SScan(ctx, key, cursor, "*", count)
+		page.scanned = page.cursor == 0
+	}
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// maxMemberOrder is the number of members up to which sorted sets can be
+// sorted by member
+const maxMemberOrder = 10000
+
+// fetchFirst fetches the number of elements and the first page of them
+// into val. Sorted sets sorted by member are fetched completely.
+func fetchFirst(ctx context.Context, store kv.KV, val *keyValue) error {
+	var err error
+	if val.total, err = store.Len(ctx, val.key); err != nil {
+		return err
+	}
+	if val.t == types.KVTypeSortedSet && val.memberOrder && val.total <= maxMemberOrder {
+		if val.members, err = store.ZRangeWithScores(ctx, val.key, 0, -1); err != nil {
+			return err
+		}
+		sort.Stable(byMember(val.members))
+		val.total = len(val.members)
+		return nil
+	}
+	val.memberOrder = false
+	page, err := fetchElements(ctx, store, val.key, val.t, 0, 0, *pageSize)
+	if err != nil {
+		return err
+	}
+	val.add(val.t, page)
+	return nil
+}
+
+// add adds a fetched page, it replaces the window of lists and sorted sets
+// and extends the scanned elements of maps and sets with the ones not
+// scanned before
+func (e *elements) add(t types.KVType, page *elementPage) {
+	if indexed(t) {
+		e.offset, e.items, e.members = page.offset, page.items, page.members
+		return
+	}
+	if e.seen == nil {
+		e.seen = make(map[string]bool)
+	}
+	for _, i := range page.items {
+		if !e.seen[i] {
+			e.seen[i] = true
+			e.items = append(e.items, i)
+		}
+	}
+	e.cursor, e.scanned = page.cursor, page.scanned
+	if e.scanned {
+		// the number of elements may have changed since it was fetched
+		e.total = len(e.items)
+	}
+}
+
+// fetched returns the number of fetched elements
+func (e *elements) fetched() int {
+	return len(e.items) + len(e.members)
+}
+
+// has reports whether the elements from start up to end are fetched
+func (e *elements) has(start, end int) bool {
+	return start >= e.offset && end <= e.offset+e.fetched()
+}
+
+// loadElements fetches more elements of val when the elements from start
+// up to end are not fetched yet, or when they are near the end of the
+// fetched elements
+func loadElements(g *gocui.Gui, val *keyValue, start, end int) {
+	if val.loading || val.loadErr != nil {
+		return
+	}
+	ahead := lookAhead()
+	var offset, count int
+	if indexed(val.t) {
+		low, high := val.offset, val.offset+val.fetched()
+		if start >= low && end <= high &&
+			(start-low >= ahead/2 || low == 0) && (high-end >= ahead/2 || high >= val.total) {
+			return
+		}
+		if offset = start - ahead; offset < 0 {
+			offset = 0
+		}
+		count = end - start + 2*ahead
+	} else {
+		if val.scanned || val.fetched() >= end+ahead {
+			return
+		}
+		count = *pageSize
+	}
+
+	val.loading = true
+	key, t, cursor := val.key, val.t, val.cursor
+	kvfetch.fetch("elements", func(ctx context.Context, store kv.KV) (interface{}, error) {
+		return fetchElements(ctx, store, key, t, offset, cursor, count)
+	}, func(g *gocui.Gui, res interface{}, err error) error {
+		val.loading = false
+		if val != currentValue {
+			return nil
+		}
+		if err != nil {
+			val.loadErr = err
+			showError(g, err)
+			return nil
+		}
+		val.add(t, res.(*elementPage))
+		return redrawView(g, valueView)
+	})
+}
+
+// renderElements renders the visible elements of a list, map, set or
+// sorted set and fetches the ones that are missing
+func renderElements(g *gocui.Gui, v *gocui.View, val *keyValue) {
+	_, h := v.Size()
+	header := 0
+	if val.t == types.KVTypeSortedSet {
+		header = 1
+	}
+	rows := h - header
+	if rows < 1 {
+		rows = 1
+	}
+
+	// keep the selected element in view
+	if val.sel >= val.total {
+		val.sel = val.total - 1
+	}
+	if val.sel < 0 {
+		val.sel = 0
+	}
+	if val.sel < val.top {
+		val.top = val.sel
+	} else if val.sel >= val.top+rows {
+		val.top = val.sel - rows + 1
+	}
+	sel := val.sel
+	v.SetOrigin(0, 0)
+	v.SetCursor(0, sel-val.top+header)
+
+	start, end := val.top, val.top+rows
+	if end > val.total {
+		end = val.total
+	}
+	if val.total == 0 {
+		shownElements = "no elements"
+	} else {
+		shownElements = fmt.Sprintf("elements %s-%s of %s", thousands(start+1), thousands(end), thousands(val.total))
+	}
+	loadElements(g, val, start, end)
+
+	if !val.has(start, end) {
+		if header > 0 {
+			renderSortedSet(v, nil, val.memberOrder)
+		}
+		fmt.Fprintln(v, loading)
+		return
+	}
+	lo, hi := start-val.offset, end-val.offset
+	switch val.t {
+	case types.KVTypeSortedSet:
+		renderSortedSet(v, val.members[lo:hi], val.memberOrder)
+	case types.KVTypeMap:
+		for _, i := range val.items[lo:hi] {
+			fmt.Fprintf(v, "- %s\n", printable(i))
+		}
+		if sel < end && val.items[sel-val.offset] != currentField {
+			currentField = val.items[sel-val.offset]
+			loadSubValue(g)
+		}
+	default:
+		for _, i := range val.items[lo:hi] {
+			fmt.Fprintf(v, "- %s\n", printable(i))
+		}
+	}
+}
+
+// scrollElements moves the selection in the value view by n elements
+func scrollElements(g *gocui.Gui, n int) error {
+	currentValue.sel += n
+	return redrawView(g, valueView)
+}
+
+// thousands formats n with thousands separators
+func thousands(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0 && s[i-1] != '-'; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/ramkv"
+	"github.com/rikvdh/kvui/kv/types"
+)
+
+func TestAddScanned(t *testing.T) {
+	e := &elements{total: 4}
+	e.add(types.KVTypeSet, &elementPage{items: []string{"a", "b"}, cursor: 7})
+	// the next page overlaps the first one, as a rehash during the scan
+	// can cause
+	e.add(types.KVTypeSet, &elementPage{items: []string{"b", "c", "a"}, cursor: 3})
+	e.add(types.KVTypeSet, &elementPage{items: []string{"c"}, scanned: true})
+
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(e.items, want) {
+		t.Errorf("items = %q, want %q", e.items, want)
+	}
+	if e.total != 3 || !e.scanned {
+		t.Errorf("total = %d, scanned = %v, want 3 elements scanned", e.total, e.scanned)
+	}
+}
+
+func TestFetchMemberOrder(t *testing.T) {
+	ctx := context.Background()
+	store, _ := ramkv.New()
+	store.ZAdd(ctx, "small", kv.Z{Member: "c", Score: 1}, kv.Z{Member: "a", Score: 2}, kv.Z{Member: "b", Score: 3})
+
+	val := &keyValue{key: "small", t: types.KVTypeSortedSet}
+	val.memberOrder = true
+	if err := fetchFirst(ctx, store, val); err != nil {
+		t.Fatal(err)
+	}
+	var members []string
+	for _, z := range val.members {
+		members = append(members, z.Member)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(members, want) || !val.memberOrder {
+		t.Errorf("members = %q, want all of them sorted by member %q", members, want)
+	}
+
+	var big []kv.Z
+	for i := 0; i <= maxMemberOrder; i++ {
+		big = append(big, kv.Z{Member: fmt.Sprint(i), Score: float64(i)})
+	}
+	store.ZAdd(ctx, "big", big...)
+	val = &keyValue{key: "big", t: types.KVTypeSortedSet}
+	val.memberOrder = true
+	if err := fetchFirst(ctx, store, val); err != nil {
+		t.Fatal(err)
+	}
+	if val.memberOrder || val.fetched() == val.total {
+		t.Errorf("a large sorted set must be paged by score")
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jroimartin/gocui"
+	"github.com/rikvdh/kvui/kv"
+)
+
+// fetchJob is a KV-storage operation queued on the fetcher
+type fetchJob struct {
+	slot string
+	gen  uint64
+	fn   func(ctx context.Context, store kv.KV) (interface{}, error)
+	done func(g *gocui.Gui, res interface{}, err error) error
+}
+
+// fetcher runs KV-storage operations on a worker goroutine, so the gocui
+// main loop never blocks on the network. Results are delivered on the main
+// loop using g.Update. Operations run one at a time, as the KV-stores are
+// not safe for concurrent use. Every tab has its own fetcher, results of a
+// tab that is not shown are held until it is shown again.
+type fetcher struct {
+	g     *gocui.Gui
+	store kv.KV
+
+	lock   sync.Mutex
+	cond   *sync.Cond
+	queue  []fetchJob
+	gens   map[string]uint64
+	closed bool
+
+	// held holds the results fetched while the tab was not shown, it is
+	// only used on the main loop
+	held []func(g *gocui.Gui) error
+}
+
+func newFetcher(g *gocui.Gui, store kv.KV) *fetcher {
+	f := &fetcher{g: g, store: store, gens: make(map[string]uint64)}
+	f.cond = sync.NewCond(&f.lock)
+	go f.worker()
+	return f
+}
+
+// fetch queues fn, which is called with the KV-store of the fetcher, and
+// calls done with its result on the main loop. Requests for the same slot
+// supersede each other: a request that is superseded before it runs is
+// skipped and the result of a superseded request is discarded. An empty
+// slot is never superseded, it is meant for writes.
+func (f *fetcher) fetch(slot string, fn func(ctx context.Context, store kv.KV) (interface{}, error), done func(g *gocui.Gui, res interface{}, err error) error) {
+	f.lock.Lock()
+	var gen uint64
+	if slot != "" {
+		f.gens[slot]++
+		gen = f.gens[slot]
+	}
+	f.queue = append(f.queue, fetchJob{slot: slot, gen: gen, fn: fn, done: done})
+	f.lock.Unlock()
+	f.cond.Signal()
+}
+
+// stale reports whether a newer request for the slot of job was issued
+func (f *fetcher) stale(job fetchJob) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return job.slot != "" && f.gens[job.slot] != job.gen
+}
+
+func (f *fetcher) worker() {
+	for {
+		f.lock.Lock()
+		for len(f.queue) == 0 && !f.closed {
+			f.cond.Wait()
+		}
+		if f.closed {
+			f.lock.Unlock()
+			return
+		}
+		job := f.queue[0]
+		f.queue = f.queue[1:]
+		f.lock.Unlock()
+
+		if f.stale(job) {
+			continue
+		}
+		ctx, cancel := opContext()
+		res, err := job.fn(ctx, f.store)
+		cancel()
+		deliver := func(g *gocui.Gui) error {
+			if f.stale(job) {
+				return nil
+			}
+			return job.done(g, res, err)
+		}
+		f.g.Update(func(g *gocui.Gui) error {
+			if kvfetch != f {
+				f.held = append(f.held, deliver)
+				return nil
+			}
+			return deliver(g)
+		})
+	}
+}
+
+// resume delivers the results held while the tab was not shown
+func (f *fetcher) resume(g *gocui.Gui) error {
+	held := f.held
+	f.held = nil
+	for _, deliver := range held {
+		if err := deliver(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close stops the worker, queued operations are dropped
+func (f *fetcher) close() {
+	f.lock.Lock()
+	f.closed = true
+	f.lock.Unlock()
+	f.cond.Signal()
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/jroimartin/gocui"
+	"github.com/rikvdh/kvui/kv/glob"
+)
+
+const (
+	highlightStart = "\x1b[33;1m"
+	highlightEnd   = "\x1b[0m"
+)
+
+// treeFilter filters the keys in the tree view, nil shows all keys
+var treeFilter *keyFilter
+
+// keyFilter is a filter on the keys in the tree view
+type keyFilter struct {
+	input string
+	// pattern is the glob passed to the KV-store
+	pattern string
+	// re filters the keys returned by the KV-store, nil when the
+	// KV-store does all filtering
+	re *regexp.Regexp
+	// hl matches the part of a key that is highlighted
+	hl *regexp.Regexp
+}
+
+// parseFilter parses the input of the filter prompt. Input starting with
+// "~" is a regular expression, input with glob characters is a glob and
+// any other input matches the keys containing it.
+func parseFilter(input string) (*keyFilter, error) {
+	f := &keyFilter{input: input}
+	switch {
+	case input == "":
+		return nil, nil
+	case strings.HasPrefix(input, "~"):
+		re, err := regexp.Compile(input[1:])
+		if err != nil {
+			return nil, err
+		}
+		f.pattern, f.re, f.hl = "*", re, re
+	case glob.HasMeta(input):
+		f.pattern = input
+		// highlight the literal parts, not the leading and trailing wildcards
+		f.hl, _ = regexp.Compile(glob.Regexp(strings.Trim(input, "*")))
+	default:
+		f.pattern = "*" + glob.Quote(input) + "*"
+		f.hl = regexp.MustCompile(regexp.QuoteMeta(input))
+	}
+	return f, nil
+}
+
+// match reports whether key passes the filter
+func (f *keyFilter) match(key string) bool {
+	if f == nil {
+		return true
+	}
+	return glob.Match(f.pattern, key) && (f.re == nil || f.re.MatchString(key))
+}
+
+// highlight returns key from offset on, with the parts matching the filter
+// highlighted
+func (f *keyFilter) highlight(key string, offset int) string {
+	s := key[offset:]
+	if f == nil || f.hl == nil {
+		return printable(s)
+	}
+	// the matches are found in the whole key, the parts of them in the
+	// namespace before offset are not shown
+	out, prev := "", 0
+	for _, m := range f.hl.FindAllStringIndex(key, -1) {
+		if m[1] <= offset || m[0] == m[1] {
+			continue
+		}
+		start, end := m[0]-offset, m[1]-offset
+		if start < 0 {
+			start = 0
+		}
+		out += printable(s[prev:start]) + highlightStart + printable(s[start:end]) + highlightEnd
+		prev = end
+	}
+	return out + printable(s[prev:])
+}
+
+// filterKeys asks for the filter on the keys in the tree view
+func filterKeys(g *gocui.Gui, v *gocui.View) error {
+	input := ""
+	if treeFilter != nil {
+		input = treeFilter.input
+	}
+	return prompt(g, "Filter keys (substring, glob or ~regexp)", input, func(g *gocui.Gui, input string) error {
+		f, err := parseFilter(input)
+		if err != nil {
+			showError(g, err)
+			return nil
+		}
+		treeFilter = f
+		resetKeys()
+		if tv, err := g.View(treeView); err == nil {
+			tv.SetOrigin(0, 0)
+			tv.SetCursor(0, 0)
+		}
+		return redrawView(g, treeView)
+	})
+}
+
+func nextMatch(g *gocui.Gui, v *gocui.View) error {
+	return jumpMatch(g, v, 1)
+}
+
+func prevMatch(g *gocui.Gui, v *gocui.View) error {
+	return jumpMatch(g, v, -1)
+}
+
+// jumpMatch moves the cursor to the next (dir 1) or previous (dir -1) key
+// matching the filter
+func jumpMatch(g *gocui.Gui, v *gocui.View, dir int) error {
+	if treeFilter == nil {
+		return nil
+	}
+	keys := treeRoot.walk(nil)
+	if len(keys) == 0 {
+		return nil
+	}
+	i := -1
+	for j, k := range keys {
+		if k == currentKey {
+			i = j
+			break
+		}
+	}
+	if i < 0 && dir < 0 {
+		i = 0
+	}
+	return selectKey(g, keys[(i+dir+len(keys))%len(keys)])
+}
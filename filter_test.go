@@ -0,0 +1,33 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+func TestHighlight(t *testing.T) {
+	hl := func(s string) string { return highlightStart + s + highlightEnd }
+	tests := []struct {
+		filter, key string
+		offset      int
+		out         string
+	}{
+		{"user", "user:1", 0, hl("user") + ":1"},
+		// the first match is in the namespace, the visible part matches too
+		{"user", "user:user", 5, hl("user")},
+		{"ab", "xab:ab:ab", 4, hl("ab") + ":" + hl("ab")},
+		// a match across the namespace is clipped
+		{"r:1", "user:1", 5, hl("1")},
+		{"nomatch", "user:1", 5, "1"},
+	}
+	for _, tt := range tests {
+		f, err := parseFilter(tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out := f.highlight(tt.key, tt.offset); out != tt.out {
+			t.Errorf("highlight(%q, %d) with filter %q = %q, want %q", tt.key, tt.offset, tt.filter, out, tt.out)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jroimartin/gocui"
+	"github.com/rikvdh/kvui/kv/types"
+)
+
+// hexToggled holds the keys for which the hex dump was toggled, binary
+// values of these keys are shown as text and text values as hex dump
+var hexToggled = make(map[string]bool)
+
+// isBinary reports whether data is no text: it is not valid UTF-8 or it
+// holds control characters other than whitespace
+func isBinary(data []byte) bool {
+	if !utf8.Valid(data) {
+		return true
+	}
+	for _, r := range string(data) {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// showsHex reports whether the value d of key is shown as hex dump
+func showsHex(key string, d decoded) bool {
+	return d.binary != hexToggled[key]
+}
+
+// hexDump returns the dump of s with per line the offset, 16 bytes in hex
+// and those bytes as printable characters
+func hexDump(s string) string {
+	return hex.Dump([]byte(s))
+}
+
+// text returns s with the characters that would mess up the terminal
+// replaced by dots
+func text(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || (unicode.IsControl(r) && !unicode.IsSpace(r)) {
+			return '.'
+		}
+		return r
+	}, s)
+}
+
+// printable returns s for a single line, with control characters including
+// newlines and invalid UTF-8 replaced by '.'. Keys, fields and members go
+// through it, so they can not send escape sequences to the terminal.
+func printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			return '.'
+		}
+		return r
+	}, s)
+}
+
+// renderDecoded writes the value d of key as hex dump or as text, it
+// returns the suffix for the title of the view
+func renderDecoded(v *gocui.View, key string, d decoded) string {
+	if showsHex(key, d) {
+		v.Write([]byte(hexDump(d.str)))
+		return "hex"
+	}
+	if d.binary {
+		v.Write([]byte(text(d.str)))
+		return "text"
+	}
+	v.Write([]byte(d.str))
+	return ""
+}
+
+// toggleHex switches the values of the selected key between hex dump and
+// text
+func toggleHex(g *gocui.Gui, v *gocui.View) error {
+	val := currentValue
+	if val == nil || (val.t != types.KVTypeString && val.t != types.KVTypeMap) {
+		return nil
+	}
+	hexToggled[val.key] = !hexToggled[val.key]
+	redrawView(g, subValueView)
+	return redrawView(g, valueView)
+}
@@ -0,0 +1,36 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrintable(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"member", "member"},
+		{"evil\x1b[2Jmember", "evil.[2Jmember"},
+		{"two\nlines\ttab", "two.lines.tab"},
+		{"bad\xffutf8", "bad.utf8"},
+		{"ünïcode", "ünïcode"},
+	}
+	for _, tt := range tests {
+		if out := printable(tt.in); out != tt.out {
+			t.Errorf("printable(%q) = %q, want %q", tt.in, out, tt.out)
+		}
+	}
+
+	f, err := parseFilter("member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hl := f.highlight("ns:\x1b]0;title\amember\x1b[0m", 3)
+	if strings.Count(hl, "\x1b") != strings.Count(highlightStart+highlightEnd, "\x1b") {
+		t.Errorf("escape sequences of the key must not pass: %q", hl)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jroimartin/gocui"
+	"github.com/rikvdh/kvui/kv/types"
+)
+
+// colors of the parts of pretty printed JSON
+const (
+	jsonKeyColor    = "\x1b[36m"
+	jsonStringColor = "\x1b[32m"
+	jsonNumberColor = "\x1b[33m"
+	jsonLitColor    = "\x1b[35m"
+	colorEnd        = "\x1b[0m"
+)
+
+// rawValues shows JSON values as they are stored instead of pretty printed
+var rawValues = false
+
+// jsonKind is the kind of a JSON value
+type jsonKind int
+
+const (
+	jsonObject jsonKind = iota
+	jsonArray
+	jsonString
+	jsonNumber
+	jsonLiteral
+)
+
+// jsonNode is a parsed JSON value, objects and arrays can be folded
+type jsonNode struct {
+	kind jsonKind
+	// key is the quoted key of the value in its parent object
+	key string
+	// literal is the JSON of strings, numbers, booleans and null
+	literal  string
+	children []*jsonNode
+	parent   *jsonNode
+	folded   bool
+}
+
+// parseJSON parses s when it holds a JSON object or array, it returns nil
+// for anything else
+func parseJSON(s string) *jsonNode {
+	s = strings.TrimSpace(s)
+	if s == "" || (s[0] != '{' && s[0] != '[') {
+		return nil
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	n, err := decodeJSON(dec)
+	if err != nil {
+		return nil
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		// trailing data
+		return nil
+	}
+	return n
+}
+
+// decodeJSON decodes the next value from dec, keeping the order of keys
+func decodeJSON(dec *json.Decoder) (*jsonNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		n := &jsonNode{kind: jsonArray}
+		if t == '{' {
+			n.kind = jsonObject
+		}
+		for dec.More() {
+			var key string
+			if n.kind == jsonObject {
+				tok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key = quoteJSON(tok.(string))
+			}
+			c, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			c.key, c.parent = key, n
+			n.children = append(n.children, c)
+		}
+		// the closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case string:
+		return &jsonNode{kind: jsonString, literal: quoteJSON(t)}, nil
+	case json.Number:
+		return &jsonNode{kind: jsonNumber, literal: t.String()}, nil
+	case bool:
+		return &jsonNode{kind: jsonLiteral, literal: strconv.FormatBool(t)}, nil
+	}
+	return &jsonNode{kind: jsonLiteral, literal: "null"}, nil
+}
+
+// quoteJSON returns s as JSON string, control characters are escaped so
+// they can't mess up the terminal
+func quoteJSON(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// size describes the number of children of an object or array
+func (n *jsonNode) size() string {
+	unit := "item"
+	if n.kind == jsonObject {
+		unit = "key"
+	}
+	if len(n.children) != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", len(n.children), unit)
+}
+
+// renderJSON writes n indented and colorized to w. It returns lines with
+// the node shown on every written line appended.
+func renderJSON(w io.Writer, n *jsonNode, depth int, comma bool, lines []*jsonNode) []*jsonNode {
+	indent := strings.Repeat("  ", depth)
+	prefix := indent
+	if n.key != "" {
+		prefix += jsonKeyColor + n.key + colorEnd + ": "
+	}
+	sep := ""
+	if comma {
+		sep = ","
+	}
+	switch n.kind {
+	case jsonObject, jsonArray:
+		open, close := "[", "]"
+		if n.kind == jsonObject {
+			open, close = "{", "}"
+		}
+		switch {
+		case len(n.children) == 0:
+			fmt.Fprintf(w, "%s%s%s%s\n", prefix, open, close, sep)
+			return append(lines, n)
+		case n.folded:
+			fmt.Fprintf(w, "%s%s…%s%s %s%s%s\n", prefix, open, close, sep, dimStart, n.size(), dimEnd)
+			return append(lines, n)
+		}
+		fmt.Fprintf(w, "%s%s\n", prefix, open)
+		lines = append(lines, n)
+		for i, c := range n.children {
+			lines = renderJSON(w, c, depth+1, i < len(n.children)-1, lines)
+		}
+		fmt.Fprintf(w, "%s%s%s\n", indent, close, sep)
+		return append(lines, n)
+	case jsonString:
+		fmt.Fprintf(w, "%s%s%s%s%s\n", prefix, jsonStringColor, n.literal, colorEnd, sep)
+	case jsonNumber:
+		fmt.Fprintf(w, "%s%s%s%s%s\n", prefix, jsonNumberColor, n.literal, colorEnd, sep)
+	default:
+		fmt.Fprintf(w, "%s%s%s%s%s\n", prefix, jsonLitColor, n.literal, colorEnd, sep)
+	}
+	return append(lines, n)
+}
+
+// jsonLines holds the JSON node shown on each line of the value view
+var jsonLines []*jsonNode
+
+// showsJSON reports whether the value view shows pretty printed JSON
+func showsJSON() bool {
+	return !rawValues && currentValue != nil && currentValue.t == types.KVTypeString &&
+		currentValue.shown.json != nil && !showsHex(currentValue.key, currentValue.shown)
+}
+
+// toggleFold folds or unfolds the JSON object or array under the cursor,
+// on other values it folds the object or array they are in
+func toggleFold(g *gocui.Gui, v *gocui.View) error {
+	if !showsJSON() {
+		return nil
+	}
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	l := cy + oy
+	if l >= len(jsonLines) {
+		return nil
+	}
+	n := jsonLines[l]
+	if len(n.children) == 0 || (n.kind != jsonObject && n.kind != jsonArray) {
+		if n = n.parent; n == nil {
+			return nil
+		}
+	}
+	n.folded = !n.folded
+	if err := redrawView(g, valueView); err != nil {
+		return err
+	}
+	// keep the cursor on the folded or unfolded value
+	for i, ln := range jsonLines {
+		if ln == n {
+			setLine(v, i)
+			break
+		}
+	}
+	return nil
+}
+
+// toggleRaw switches between pretty printed and raw JSON values
+func toggleRaw(g *gocui.Gui, v *gocui.View) error {
+	rawValues = !rawValues
+	redrawView(g, subValueView)
+	return redrawView(g, valueView)
+}
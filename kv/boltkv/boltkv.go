@@ -0,0 +1,616 @@
+package boltkv
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/glob"
+	"github.com/rikvdh/kvui/kv/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+func init() {
+	kv.Register(kv.TypeBolt, func(params string) (kv.KV, error) {
+		return New(params)
+	})
+}
+
+// Boltkv stores the values that is set or retrieved in a BoltDB file.
+// Top-level buckets are exposed as databases, nested buckets as maps and
+// plain values as strings. The file is opened read-only, so other
+// processes can use it too, and only opened read-write during an edit.
+type Boltkv struct {
+	// lock guards db and bucket, transactions hold it so the file is not
+	// closed or opened again under them
+	lock   sync.RWMutex
+	db     *bolt.DB
+	path   string
+	bucket []byte
+	// openErr is why opening the file again failed, db is nil then
+	openErr error
+
+	// scans holds where the Scan cursors continue, guarded by scanLock
+	scanLock sync.Mutex
+	scans    map[uint64]scanState
+	lastScan uint64
+}
+
+// scanState is where a Scan iteration continues, after the key after
+type scanState struct {
+	pattern string
+	after   []byte
+}
+
+var (
+	// errNoBucket is returned when there is no top-level bucket selected
+	errNoBucket = fmt.Errorf("no bucket selected")
+	errClosed   = fmt.Errorf("database closed")
+)
+
+func toBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return []byte(fmt.Sprintf("%v", value))
+}
+
+// view runs fn in a read-only transaction on the selected bucket
+func (b *Boltkv) view(ctx context.Context, fn func(*bolt.Bucket) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.db == nil {
+		return b.closed()
+	}
+	name := b.bucket
+	if name == nil {
+		return errNoBucket
+	}
+	return b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(name)
+		if bkt == nil {
+			return fmt.Errorf("bucket %s not found", name)
+		}
+		return fn(bkt)
+	})
+}
+
+// update runs fn in a read-write transaction on the selected bucket, the
+// file is opened read-write for it
+func (b *Boltkv) update(ctx context.Context, fn func(*bolt.Bucket) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.db == nil {
+		return b.closed()
+	}
+	name := b.bucket
+	if name == nil {
+		return errNoBucket
+	}
+	if err := b.open(false); err != nil {
+		// keep browsing the file
+		if rerr := b.open(true); rerr != nil {
+			return fmt.Errorf("%v, opening read-only again: %v", err, rerr)
+		}
+		return err
+	}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(name)
+		if bkt == nil {
+			return fmt.Errorf("bucket %s not found", name)
+		}
+		return fn(bkt)
+	})
+	if rerr := b.open(true); rerr != nil {
+		if err == nil {
+			return fmt.Errorf("opening read-only again: %v", rerr)
+		}
+		return fmt.Errorf("%v, opening read-only again: %v", err, rerr)
+	}
+	return err
+}
+
+// Get returns the value from the requested key.
+func (b *Boltkv) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := b.view(ctx, func(bkt *bolt.Bucket) error {
+		if bkt.Bucket([]byte(key)) != nil {
+			return fmt.Errorf("key %s is a bucket", key)
+		}
+		v := bkt.Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("key %s not found", key)
+		}
+		value = append([]byte(nil), v...)
+		return nil
+	})
+	return value, err
+}
+
+// Set stores the value with the given key
+func (b *Boltkv) Set(ctx context.Context, key string, value interface{}) error {
+	return b.update(ctx, func(bkt *bolt.Bucket) error {
+		return bkt.Put([]byte(key), toBytes(value))
+	})
+}
+
+// Del removes the value or nested bucket with the given key
+func (b *Boltkv) Del(ctx context.Context, key string) error {
+	return b.update(ctx, func(bkt *bolt.Bucket) error {
+		if bkt.Bucket([]byte(key)) != nil {
+			return bkt.DeleteBucket([]byte(key))
+		}
+		return bkt.Delete([]byte(key))
+	})
+}
+
+// Keys returns a list of keys in the selected bucket matched by pattern
+func (b *Boltkv) Keys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	err := b.view(ctx, func(bkt *bolt.Bucket) error {
+		return bkt.ForEach(func(k, v []byte) error {
+			if glob.Match(pattern, string(k)) {
+				keys = append(keys, string(k))
+			}
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// Scan returns the keys matched by pattern of the next count keys. Bolt
+// keeps keys sorted, the cursor continues after the last key of the
+// previous page.
+func (b *Boltkv) Scan(ctx context.Context, cursor uint64, pattern string, count int) (uint64, []string, error) {
+	if count <= 0 {
+		count = kv.DefaultScanCount
+	}
+	var after []byte
+	b.scanLock.Lock()
+	if cursor == 0 {
+		// a new iteration, drop the abandoned ones of pattern
+		for c, s := range b.scans {
+			if s.pattern == pattern {
+				delete(b.scans, c)
+			}
+		}
+	} else {
+		s, ok := b.scans[cursor]
+		if !ok || s.pattern != pattern {
+			b.scanLock.Unlock()
+			return 0, nil, fmt.Errorf("invalid cursor: %d", cursor)
+		}
+		delete(b.scans, cursor)
+		after = s.after
+	}
+	b.scanLock.Unlock()
+
+	var keys []string
+	var last []byte
+	err := b.view(ctx, func(bkt *bolt.Bucket) error {
+		c := bkt.Cursor()
+		k, _ := c.First()
+		if after != nil {
+			if k, _ = c.Seek(after); bytes.Equal(k, after) {
+				k, _ = c.Next()
+			}
+		}
+		for n := 0; k != nil && n < count; n++ {
+			if glob.Match(pattern, string(k)) {
+				keys = append(keys, string(k))
+			}
+			last = append(last[:0], k...)
+			k, _ = c.Next()
+		}
+		if k == nil {
+			last = nil
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if last == nil {
+		return 0, keys, nil
+	}
+
+	b.scanLock.Lock()
+	defer b.scanLock.Unlock()
+	if b.scans == nil {
+		b.scans = make(map[uint64]scanState)
+	}
+	b.lastScan++
+	b.scans[b.lastScan] = scanState{pattern: pattern, after: last}
+	return b.lastScan, keys, nil
+}
+
+// nested runs fn on the nested bucket key in the selected bucket
+func nested(bkt *bolt.Bucket, key string, fn func(*bolt.Bucket) error) error {
+	n := bkt.Bucket([]byte(key))
+	if n == nil {
+		return fmt.Errorf("key %s not found", key)
+	}
+	return fn(n)
+}
+
+// HKeys returns all keys in a nested bucket
+func (b *Boltkv) HKeys(ctx context.Context, key string) ([]string, error) {
+	var keys []string
+	err := b.view(ctx, func(bkt *bolt.Bucket) error {
+		return nested(bkt, key, func(n *bolt.Bucket) error {
+			return n.ForEach(func(k, v []byte) error {
+				keys = append(keys, string(k))
+				return nil
+			})
+		})
+	})
+	return keys, err
+}
+
+// HScan returns a page of at most count fields of a nested bucket matched
+// by pattern, the cursor is an offset in the matched fields
+func (b *Boltkv) HScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []string, error) {
+	var fields []string
+	err := b.view(ctx, func(bkt *bolt.Bucket) error {
+		return nested(bkt, key, func(n *bolt.Bucket) error {
+			return n.ForEach(func(k, v []byte) error {
+				if glob.Match(pattern, string(k)) {
+					fields = append(fields, string(k))
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	next, page := kv.ScanSlice(fields, cursor, count)
+	return next, page, nil
+}
+
+// Len returns the number of fields in a nested bucket
+func (b *Boltkv) Len(ctx context.Context, key string) (int, error) {
+	var n int
+	err := b.view(ctx, func(bkt *bolt.Bucket) error {
+		if bkt.Bucket([]byte(key)) == nil && bkt.Get([]byte(key)) != nil {
+			return fmt.Errorf("%s is a %s, it has no elements", key, types.KVTypeString)
+		}
+		return nested(bkt, key, func(nb *bolt.Bucket) error {
+			return nb.ForEach(func(k, v []byte) error {
+				n++
+				return nil
+			})
+		})
+	})
+	return n, err
+}
+
+// HGet retrieve the value from the given field in the given nested bucket
+func (b *Boltkv) HGet(ctx context.Context, key, field string) ([]byte, error) {
+	var value []byte
+	err := b.view(ctx, func(bkt *bolt.Bucket) error {
+		return nested(bkt, key, func(n *bolt.Bucket) error {
+			if n.Bucket([]byte(field)) != nil {
+				return fmt.Errorf("field %s is a bucket", field)
+			}
+			v := n.Get([]byte(field))
+			if v == nil {
+				return fmt.Errorf("field %s not found", field)
+			}
+			value = append([]byte(nil), v...)
+			return nil
+		})
+	})
+	return value, err
+}
+
+// HSet sets the value in the given field in the given nested bucket,
+// the bucket is created when it does not exist
+func (b *Boltkv) HSet(ctx context.Context, key, field string, value interface{}) error {
+	return b.update(ctx, func(bkt *bolt.Bucket) error {
+		n, err := bkt.CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return err
+		}
+		return n.Put([]byte(field), toBytes(value))
+	})
+}
+
+// HDel removes the value in the given field in the given nested bucket
+func (b *Boltkv) HDel(ctx context.Context, key, field string) error {
+	return b.update(ctx, func(bkt *bolt.Bucket) error {
+		return nested(bkt, key, func(n *bolt.Bucket) error {
+			if n.Bucket([]byte(field)) != nil {
+				return n.DeleteBucket([]byte(field))
+			}
+			return n.Delete([]byte(field))
+		})
+	})
+}
+
+// LGet is not supported, BoltDB has no list type
+func (b *Boltkv) LGet(ctx context.Context, key string) ([]string, error) {
+	return nil, kv.ErrNotSupported
+}
+
+// LRange is not supported, BoltDB has no list type
+func (b *Boltkv) LRange(ctx context.Context, key string, offset, count int) ([]string, error) {
+	return nil, kv.ErrNotSupported
+}
+
+// RPush is not supported, BoltDB has no list type
+func (b *Boltkv) RPush(ctx context.Context, key string, values ...interface{}) error {
+	return kv.ErrNotSupported
+}
+
+// SMembers is not supported, BoltDB has no set type
+func (b *Boltkv) SMembers(ctx context.Context, key string) ([]string, error) {
+	return nil, kv.ErrNotSupported
+}
+
+// SScan is not supported, BoltDB has no set type
+func (b *Boltkv) SScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []string, error) {
+	return 0, nil, kv.ErrNotSupported
+}
+
+// ZScan is not supported, BoltDB has no sorted set type
+func (b *Boltkv) ZScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []kv.Z, error) {
+	return 0, nil, kv.ErrNotSupported
+}
+
+// ZRangeWithScores is not supported, BoltDB has no sorted set type
+func (b *Boltkv) ZRangeWithScores(ctx context.Context, key string, start, stop int) ([]kv.Z, error) {
+	return nil, kv.ErrNotSupported
+}
+
+// SAdd is not supported, BoltDB has no set type
+func (b *Boltkv) SAdd(ctx context.Context, key string, members ...interface{}) error {
+	return kv.ErrNotSupported
+}
+
+// ZAdd is not supported, BoltDB has no sorted set type
+func (b *Boltkv) ZAdd(ctx context.Context, key string, members ...kv.Z) error {
+	return kv.ErrNotSupported
+}
+
+// Expire is not supported, BoltDB values do not expire
+func (b *Boltkv) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return kv.ErrNotSupported
+}
+
+// TTL is always negative when key exists, BoltDB values do not expire
+func (b *Boltkv) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if _, err := b.Type(ctx, key); err != nil {
+		return 0, err
+	}
+	return -1, nil
+}
+
+// Persist does nothing when key exists, BoltDB values do not expire
+func (b *Boltkv) Persist(ctx context.Context, key string) error {
+	_, err := b.Type(ctx, key)
+	return err
+}
+
+// dump is the serialized form of a value or nested bucket
+type dump struct {
+	Value    []byte
+	IsBucket bool
+	Bucket   map[string]*dump
+}
+
+// dumpBucket serializes bkt and its nested buckets
+func dumpBucket(bkt *bolt.Bucket) *dump {
+	d := &dump{IsBucket: true, Bucket: make(map[string]*dump)}
+	bkt.ForEach(func(k, v []byte) error {
+		if v == nil {
+			d.Bucket[string(k)] = dumpBucket(bkt.Bucket(k))
+		} else {
+			d.Bucket[string(k)] = &dump{Value: append([]byte(nil), v...)}
+		}
+		return nil
+	})
+	return d
+}
+
+// restore writes d to key in bkt
+func (d *dump) restore(bkt *bolt.Bucket, key []byte) error {
+	if !d.IsBucket {
+		return bkt.Put(key, d.Value)
+	}
+	n, err := bkt.CreateBucket(key)
+	if err != nil {
+		return err
+	}
+	for k, v := range d.Bucket {
+		if err := v.restore(n, []byte(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dump serializes the value or nested bucket stored at key
+func (b *Boltkv) Dump(ctx context.Context, key string) ([]byte, error) {
+	var d *dump
+	err := b.view(ctx, func(bkt *bolt.Bucket) error {
+		if n := bkt.Bucket([]byte(key)); n != nil {
+			d = dumpBucket(n)
+		} else if v := bkt.Get([]byte(key)); v != nil {
+			d = &dump{Value: append([]byte(nil), v...)}
+		} else {
+			return fmt.Errorf("key %s not found", key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = gob.NewEncoder(&buf).Encode(d)
+	return buf.Bytes(), err
+}
+
+// Restore creates key from data serialized by Dump, the ttl is ignored
+func (b *Boltkv) Restore(ctx context.Context, key string, ttl time.Duration, data []byte) error {
+	var d dump
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&d); err != nil {
+		return err
+	}
+	return b.update(ctx, func(bkt *bolt.Bucket) error {
+		if bkt.Bucket([]byte(key)) != nil || bkt.Get([]byte(key)) != nil {
+			return fmt.Errorf("key %s already exists", key)
+		}
+		return d.restore(bkt, []byte(key))
+	})
+}
+
+// buckets returns the names of all top-level buckets in key order
+func (b *Boltkv) buckets(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.db == nil {
+		return nil, b.closed()
+	}
+	var names []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			names = append(names, string(name))
+			return nil
+		})
+	})
+	return names, err
+}
+
+// Databases returns the number of top-level buckets
+func (b *Boltkv) Databases(ctx context.Context) (int, error) {
+	names, err := b.buckets(ctx)
+	return len(names), err
+}
+
+// Database selects the top-level bucket with the given index
+func (b *Boltkv) Database(ctx context.Context, db int) error {
+	names, err := b.buckets(ctx)
+	if err != nil {
+		return err
+	}
+	if db < 0 || db >= len(names) {
+		return fmt.Errorf("invalid database: %d", db)
+	}
+	b.lock.Lock()
+	b.bucket = []byte(names[db])
+	b.lock.Unlock()
+	return nil
+}
+
+// DatabaseName returns the name of the top-level bucket with the given index
+func (b *Boltkv) DatabaseName(ctx context.Context, db int) (string, error) {
+	names, err := b.buckets(ctx)
+	if err != nil {
+		return "", err
+	}
+	if db < 0 || db >= len(names) {
+		return "", fmt.Errorf("invalid database: %d", db)
+	}
+	return names[db], nil
+}
+
+// Connected is true as long as the database file is open
+func (b *Boltkv) Connected(ctx context.Context) (bool, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.db == nil {
+		return false, b.closed()
+	}
+	return true, nil
+}
+
+// Type returns KVTypeMap for nested buckets and KVTypeString for values
+func (b *Boltkv) Type(ctx context.Context, key string) (types.KVType, error) {
+	t := types.KVTypeInvalid
+	err := b.view(ctx, func(bkt *bolt.Bucket) error {
+		if bkt.Bucket([]byte(key)) != nil {
+			t = types.KVTypeMap
+			return nil
+		}
+		if bkt.Get([]byte(key)) != nil {
+			t = types.KVTypeString
+			return nil
+		}
+		return &kv.NotFoundError{Key: key}
+	})
+	return t, err
+}
+
+// Close closes the database file, it waits for running transactions
+func (b *Boltkv) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.db == nil {
+		return nil
+	}
+	err := b.db.Close()
+	b.db = nil
+	return err
+}
+
+// open closes the database file when it is open and opens it read-only or
+// read-write, b.lock must be held
+func (b *Boltkv) open(readOnly bool) error {
+	if b.db != nil {
+		b.db.Close()
+		b.db = nil
+	}
+	db, err := bolt.Open(b.path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: readOnly})
+	b.db, b.openErr = db, err
+	return err
+}
+
+// closed returns the error of calls on a closed database, with the reason
+// opening it again failed
+func (b *Boltkv) closed() error {
+	if b.openErr != nil {
+		return fmt.Errorf("%v: %v", errClosed, b.openErr)
+	}
+	return errClosed
+}
+
+// New opens the BoltDB file at path and selects the first top-level bucket.
+// The file must exist, it is not created.
+func New(path string) (*Boltkv, error) {
+	// bolt creates a missing file, also when opening it read-only
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	boltkv := Boltkv{path: path}
+	if err := boltkv.open(true); err != nil {
+		return nil, err
+	}
+
+	names, err := boltkv.buckets(context.Background())
+	if err != nil {
+		boltkv.Close()
+		return nil, err
+	}
+	if len(names) > 0 {
+		boltkv.bucket = []byte(names[0])
+	}
+	return &boltkv, nil
+}
@@ -0,0 +1,300 @@
+package boltkv
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/types"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+var ctx = context.Background()
+
+func newTestDB(t *testing.T) (*Boltkv, func()) {
+	dir, err := ioutil.TempDir("", "boltkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test.db")
+
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		users, err := tx.CreateBucket([]byte("users"))
+		if err != nil {
+			return err
+		}
+		users.Put([]byte("user:1"), []byte("rik"))
+		users.Put([]byte("user:2"), []byte("bats"))
+		profile, err := users.CreateBucket([]byte("profile:1"))
+		if err != nil {
+			return err
+		}
+		profile.Put([]byte("name"), []byte("rik"))
+		profile.CreateBucket([]byte("deeper"))
+		_, err = tx.CreateBucket([]byte("sessions"))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	kvStorage, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kvStorage, func() {
+		kvStorage.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDatabases(t *testing.T) {
+	kvStorage, cleanup := newTestDB(t)
+	defer cleanup()
+
+	n, err := kvStorage.Databases(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	name, err := kvStorage.DatabaseName(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "users", name)
+
+	_, err = kvStorage.DatabaseName(ctx, 2)
+	assert.NotNil(t, err)
+
+	assert.NotNil(t, kvStorage.Database(ctx, 5))
+
+	// first bucket (sessions) is selected and empty
+	keys, err := kvStorage.Keys(ctx, "*")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestGetSetDel(t *testing.T) {
+	kvStorage, cleanup := newTestDB(t)
+	defer cleanup()
+	assert.Nil(t, kvStorage.Database(ctx, 1))
+
+	value, err := kvStorage.Get(ctx, "user:1")
+	assert.Nil(t, err)
+	assert.Equal(t, "rik", string(value))
+
+	_, err = kvStorage.Get(ctx, "profile:1")
+	assert.NotNil(t, err)
+
+	_, err = kvStorage.Get(ctx, "user:3")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, kvStorage.Set(ctx, "user:3", 42))
+	value, err = kvStorage.Get(ctx, "user:3")
+	assert.Nil(t, err)
+	assert.Equal(t, "42", string(value))
+
+	assert.Nil(t, kvStorage.Del(ctx, "user:3"))
+	_, err = kvStorage.Get(ctx, "user:3")
+	assert.NotNil(t, err)
+
+	binary := []byte{0x1f, 0x8b, 0x00, 0xff, 0xfe}
+	assert.Nil(t, kvStorage.Set(ctx, "bin", binary))
+	value, err = kvStorage.Get(ctx, "bin")
+	assert.Nil(t, err)
+	assert.Equal(t, binary, value)
+
+	assert.Nil(t, kvStorage.Del(ctx, "profile:1"))
+	_, err = kvStorage.Type(ctx, "profile:1")
+	assert.IsType(t, &kv.NotFoundError{}, err)
+}
+
+func TestKeysAndType(t *testing.T) {
+	kvStorage, cleanup := newTestDB(t)
+	defer cleanup()
+	assert.Nil(t, kvStorage.Database(ctx, 1))
+
+	keys, err := kvStorage.Keys(ctx, "*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"profile:1", "user:1", "user:2"}, keys)
+
+	keys, err = kvStorage.Keys(ctx, "user:*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:1", "user:2"}, keys)
+
+	tp, err := kvStorage.Type(ctx, "user:1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.KVTypeString, tp)
+
+	tp, err = kvStorage.Type(ctx, "profile:1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.KVTypeMap, tp)
+
+	_, err = kvStorage.LGet(ctx, "user:1")
+	assert.NotNil(t, err)
+}
+
+func TestHashes(t *testing.T) {
+	kvStorage, cleanup := newTestDB(t)
+	defer cleanup()
+	assert.Nil(t, kvStorage.Database(ctx, 1))
+
+	fields, err := kvStorage.HKeys(ctx, "profile:1")
+	assert.Nil(t, err)
+	sort.Strings(fields)
+	assert.Equal(t, []string{"deeper", "name"}, fields)
+
+	n, err := kvStorage.Len(ctx, "profile:1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	cursor, fields, err := kvStorage.HScan(ctx, "profile:1", 0, "*", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), cursor)
+	assert.Equal(t, []string{"deeper"}, fields)
+
+	value, err := kvStorage.HGet(ctx, "profile:1", "name")
+	assert.Nil(t, err)
+	assert.Equal(t, "rik", string(value))
+
+	_, err = kvStorage.HGet(ctx, "profile:1", "deeper")
+	assert.NotNil(t, err)
+
+	_, err = kvStorage.HGet(ctx, "profile:2", "name")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, kvStorage.HSet(ctx, "profile:2", "name", "bats"))
+	value, err = kvStorage.HGet(ctx, "profile:2", "name")
+	assert.Nil(t, err)
+	assert.Equal(t, "bats", string(value))
+
+	assert.Nil(t, kvStorage.HDel(ctx, "profile:2", "name"))
+	_, err = kvStorage.HGet(ctx, "profile:2", "name")
+	assert.NotNil(t, err)
+}
+
+func TestDumpRestore(t *testing.T) {
+	kvStorage, cleanup := newTestDB(t)
+	defer cleanup()
+	assert.Implements(t, (*kv.Dumper)(nil), kvStorage)
+	assert.Nil(t, kvStorage.Database(ctx, 1))
+
+	data, err := kvStorage.Dump(ctx, "profile:1")
+	assert.Nil(t, err)
+	assert.NotNil(t, kvStorage.Restore(ctx, "profile:1", 0, data))
+	assert.Nil(t, kvStorage.Del(ctx, "profile:1"))
+	assert.Nil(t, kvStorage.Restore(ctx, "profile:1", 0, data))
+
+	value, err := kvStorage.HGet(ctx, "profile:1", "name")
+	assert.Nil(t, err)
+	assert.Equal(t, "rik", string(value))
+	fields, err := kvStorage.HKeys(ctx, "profile:1")
+	assert.Nil(t, err)
+	assert.Len(t, fields, 2)
+
+	ttl, err := kvStorage.TTL(ctx, "profile:1")
+	assert.Nil(t, err)
+	assert.True(t, ttl < 0)
+
+	_, err = kvStorage.Dump(ctx, "missing")
+	assert.NotNil(t, err)
+}
+
+func TestOpen(t *testing.T) {
+	kvStorage, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// the file is shared with other readers, also after an edit
+	other, err := bolt.Open(kvStorage.path, 0600, &bolt.Options{Timeout: 100 * time.Millisecond, ReadOnly: true})
+	if assert.Nil(t, err) {
+		other.Close()
+	}
+	assert.Nil(t, kvStorage.Database(ctx, 1))
+	assert.Nil(t, kvStorage.Set(ctx, "user:3", "new"))
+	other, err = bolt.Open(kvStorage.path, 0600, &bolt.Options{Timeout: 100 * time.Millisecond, ReadOnly: true})
+	if assert.Nil(t, err) {
+		other.Close()
+	}
+	value, err := kvStorage.Get(ctx, "user:3")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), value)
+
+	// a missing file is not created
+	missing := filepath.Join(filepath.Dir(kvStorage.path), "missing.db")
+	_, err = New(missing)
+	assert.NotNil(t, err)
+	_, err = os.Stat(missing)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestClose(t *testing.T) {
+	kvStorage, cleanup := newTestDB(t)
+	defer cleanup()
+	assert.Nil(t, kvStorage.Database(ctx, 1))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if _, err := kvStorage.Get(ctx, "user:1"); err != nil {
+				assert.Equal(t, errClosed, err)
+				return
+			}
+		}
+	}()
+	assert.Nil(t, kvStorage.Close())
+	<-done
+	connected, err := kvStorage.Connected(ctx)
+	assert.False(t, connected)
+	assert.Equal(t, errClosed, err)
+}
+
+func TestScan(t *testing.T) {
+	kvStorage, cleanup := newTestDB(t)
+	defer cleanup()
+	assert.Nil(t, kvStorage.Database(ctx, 1))
+
+	// the users bucket holds profile:1, user:1 and user:2
+	var keys []string
+	var cursor uint64
+	rounds := 0
+	for {
+		next, page, err := kvStorage.Scan(ctx, cursor, "user:*", 1)
+		assert.Nil(t, err)
+		keys = append(keys, page...)
+		rounds++
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"user:1", "user:2"}, keys)
+	assert.Equal(t, 3, rounds)
+
+	_, _, err := kvStorage.Scan(ctx, 12345, "user:*", 1)
+	assert.NotNil(t, err)
+}
+
+func TestReopenError(t *testing.T) {
+	kvStorage, cleanup := newTestDB(t)
+	defer cleanup()
+	assert.Nil(t, kvStorage.Database(ctx, 1))
+
+	// the file can't be opened again
+	assert.Nil(t, os.Remove(kvStorage.path))
+	assert.Nil(t, os.Mkdir(kvStorage.path, 0700))
+	err := kvStorage.Set(ctx, "user:3", "new")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "opening read-only again")
+	}
+	_, err = kvStorage.Connected(ctx)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "is a directory")
+	}
+}
@@ -0,0 +1,173 @@
+// Package glob implements the glob-style pattern matching used by the
+// Redis KEYS and SCAN commands, so backends without server-side pattern
+// support can match keys the same way.
+package glob
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// Match reports whether name matches the glob pattern. Supported are
+// '*' (any sequence), '?' (any single character), '[abc]', '[^abc]',
+// '[a-z]' and '\' to escape a special character.
+func Match(pattern, name string) bool {
+	p := []rune(pattern)
+	s := []rune(name)
+	return match(p, s)
+}
+
+func match(p, s []rune) bool {
+	for len(p) > 0 {
+		switch p[0] {
+		case '*':
+			for len(p) > 1 && p[1] == '*' {
+				p = p[1:]
+			}
+			if len(p) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if match(p[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			p = p[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			n, ok := matchClass(p[1:], s[0])
+			if !ok {
+				return false
+			}
+			p = p[1+n:]
+			s = s[1:]
+		case '\\':
+			if len(p) >= 2 {
+				p = p[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || p[0] != s[0] {
+				return false
+			}
+			s = s[1:]
+			p = p[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// matchClass matches c against the character class at the start of p
+// (just after the '['). It returns the number of runes consumed from p,
+// including the closing ']'.
+func matchClass(p []rune, c rune) (int, bool) {
+	i := 0
+	not := false
+	if i < len(p) && p[i] == '^' {
+		not = true
+		i++
+	}
+	matched := false
+	for i < len(p) && p[i] != ']' {
+		switch {
+		case p[i] == '\\' && i+1 < len(p):
+			i++
+			if p[i] == c {
+				matched = true
+			}
+			i++
+		case i+2 < len(p) && p[i+1] == '-' && p[i+2] != ']':
+			lo, hi := p[i], p[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				matched = true
+			}
+			i += 3
+		default:
+			if p[i] == c {
+				matched = true
+			}
+			i++
+		}
+	}
+	if i < len(p) {
+		// consume the closing ']'
+		i++
+	}
+	if not {
+		matched = !matched
+	}
+	return i, matched
+}
+
+// HasMeta reports whether pattern contains any special glob characters.
+func HasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// Quote escapes the special glob characters in s, so the returned pattern
+// only matches s itself.
+func Quote(s string) string {
+	var b bytes.Buffer
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// Regexp converts the glob pattern to a regular expression matching the
+// same names. The expression is not anchored, anchor it with "^" and "$"
+// to match whole names only.
+func Regexp(pattern string) string {
+	var b bytes.Buffer
+	p := []rune(pattern)
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			j := i + 1
+			b.WriteRune('[')
+			if j < len(p) && p[j] == '^' {
+				b.WriteRune('^')
+				j++
+			}
+			for ; j < len(p) && p[j] != ']'; j++ {
+				if p[j] == '\\' && j+1 < len(p) {
+					j++
+				}
+				if strings.ContainsRune(`\[]^`, p[j]) {
+					b.WriteRune('\\')
+				}
+				b.WriteRune(p[j])
+			}
+			b.WriteRune(']')
+			i = j
+		case '\\':
+			if i+1 < len(p) {
+				i++
+			}
+			fallthrough
+		default:
+			b.WriteString(regexp.QuoteMeta(string(p[i])))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package glob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "session:1", false},
+		{"*:1", "user:1", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a**b", "ab", true},
+		{"exact", "exact", true},
+		{"exact", "exactly", false},
+		{"", "", true},
+		{"", "x", false},
+	}
+
+	for _, tt := range tests {
+		if m := Match(tt.pattern, tt.name); m != tt.match {
+			t.Errorf("Match(%q, %q) = %v, expected %v", tt.pattern, tt.name, m, tt.match)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for _, s := range []string{"plain", "a*b", "what?", "[x]", `back\slash`} {
+		if !Match(Quote(s), s) {
+			t.Errorf("Match(Quote(%q), %q) = false", s, s)
+		}
+		if HasMeta(s) && Match(Quote(s), s+"x") {
+			t.Errorf("Quote(%q) = %q matches too much", s, Quote(s))
+		}
+	}
+	if HasMeta("user:1") {
+		t.Error("HasMeta must be false for a plain name")
+	}
+}
+
+func TestRegexp(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{"user:*", `user:.*`},
+		{"h?llo", `h.llo`},
+		{"h[^e]llo", `h[^e]llo`},
+		{"h[a-b]llo", `h[a-b]llo`},
+		{`h[\]]llo`, `h[\]]llo`},
+		{`h\*llo`, `h\*llo`},
+		{"a.b", `a\.b`},
+	}
+
+	for _, tt := range tests {
+		if re := Regexp(tt.pattern); re != tt.expected {
+			t.Errorf("Regexp(%q) = %q, expected %q", tt.pattern, re, tt.expected)
+		}
+	}
+}
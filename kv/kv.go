@@ -1,28 +1,132 @@
 package kv
 
 import (
-	"github.com/rikvdh/kvui/kv/rediskv"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/rikvdh/kvui/kv/types"
 )
 
-// KV represents a interface with functions to get and set persistent data
+// KV represents a interface with functions to get and set persistent data.
+// Every operation takes a context, backends should give up when the
+// context is canceled or its deadline is exceeded.
 type KV interface {
-	Databases() (int, error)
-	Database(int) error
-	Connected() (bool, error)
-	Type(string) (types.KVType, error)
+	Databases(context.Context) (int, error)
+	Database(context.Context, int) error
+	DatabaseName(context.Context, int) (string, error)
+	Connected(context.Context) (bool, error)
+	Type(context.Context, string) (types.KVType, error)
+
+	Keys(context.Context, string) ([]string, error)
+	Scan(ctx context.Context, cursor uint64, pattern string, count int) (uint64, []string, error)
+	// Get returns the value stored at key as it is stored, values are
+	// not necessarily valid UTF-8
+	Get(context.Context, string) ([]byte, error)
+	Set(context.Context, string, interface{}) error
+	Del(context.Context, string) error
+
+	HKeys(context.Context, string) ([]string, error)
+	// HScan returns the next cursor and a page of the fields of a map
+	// matched by pattern, like Scan does for keys
+	HScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []string, error)
+	HGet(context.Context, string, string) ([]byte, error)
+	HSet(context.Context, string, string, interface{}) error
+	HDel(context.Context, string, string) error
+
+	LGet(context.Context, string) ([]string, error)
+	// LRange returns at most count elements of a list starting at index
+	// offset
+	LRange(ctx context.Context, key string, offset, count int) ([]string, error)
+	RPush(context.Context, string, ...interface{}) error
+
+	SMembers(context.Context, string) ([]string, error)
+	SScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []string, error)
+	SAdd(context.Context, string, ...interface{}) error
+	// ZRangeWithScores returns the members from index start up to and
+	// including stop, ordered by score. Negative indexes count from the end.
+	ZRangeWithScores(ctx context.Context, key string, start, stop int) ([]Z, error)
+	ZAdd(context.Context, string, ...Z) error
+	ZScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []Z, error)
+	// Len returns the number of elements in the list, map, set, sorted set
+	// or stream stored at key
+	Len(context.Context, string) (int, error)
+
+	Expire(context.Context, string, time.Duration) error
+	// TTL returns the time left before key expires, it is negative for
+	// keys without expiration
+	TTL(context.Context, string) (time.Duration, error)
+	// Persist removes the expiration of key
+	Persist(context.Context, string) error
+}
+
+// Noder is implemented by KV-stores that connect to one of several nodes,
+// Node describes the node in use
+type Noder interface {
+	Node() string
+}
+
+// Clusterer is implemented by KV-stores that can be spread over several
+// nodes. When Cluster reports true their databases are nodes.
+type Clusterer interface {
+	Cluster() bool
+}
+
+// Streamer is implemented by KV-stores that have streams
+type Streamer interface {
+	// XRange returns at most count entries of a stream with an ID from
+	// start up to and including end, "-" and "+" are the lowest and highest
+	// possible ID. XRevRange returns them in reverse order.
+	XRange(ctx context.Context, key, start, end string, count int) ([]XMessage, error)
+	XRevRange(ctx context.Context, key, end, start string, count int) ([]XMessage, error)
+	XInfoGroups(context.Context, string) ([]XInfoGroup, error)
+	XInfoConsumers(ctx context.Context, key, group string) ([]XInfoConsumer, error)
+}
+
+// Dumper is implemented by KV-stores that can serialize keys
+type Dumper interface {
+	// Dump serializes the value stored at key in a backend specific
+	// format, Restore creates key from it again
+	Dump(context.Context, string) ([]byte, error)
+	Restore(ctx context.Context, key string, ttl time.Duration, data []byte) error
+}
+
+// TTLBatcher is implemented by KV-stores that fetch the TTLs of several keys
+// at once. TTLs holds the keys that exist, with a negative TTL for keys
+// without expiration.
+type TTLBatcher interface {
+	TTLs(ctx context.Context, keys []string) (map[string]time.Duration, error)
+}
+
+// XMessage is an entry of a stream, Values holds its fields and values
+// as field, value, field, value...
+type XMessage struct {
+	ID     string
+	Values []string
+}
 
-	Keys(string) ([]string, error)
-	Get(string) (string, error)
-	Set(string, interface{}) error
-	Del(string) error
+// XInfoGroup is a consumer group of a stream
+type XInfoGroup struct {
+	Name            string
+	Consumers       int64
+	Pending         int64
+	LastDeliveredID string
+}
 
-	HKeys(string) ([]string, error)
-	HGet(string, string) (string, error)
-	HSet(string, string, interface{}) error
-	HDel(string, string) error
+// XInfoConsumer is a consumer in a consumer group of a stream
+type XInfoConsumer struct {
+	Name    string
+	Pending int64
+	Idle    time.Duration
+}
 
-	LGet(string) ([]string, error)
+// Z is a member of a sorted set with its score
+type Z struct {
+	Score  float64
+	Member string
 }
 
 const (
@@ -30,16 +134,97 @@ const (
 	TypeRedis string = "redis"
 	// TypeRAM is a RAM-only KV-store
 	TypeRAM string = "ram"
+	// TypeBolt is a BoltDB file KV-store
+	TypeBolt string = "bolt"
+	// TypeMemcached is a Memcached KV-store
+	TypeMemcached string = "memcached"
 )
 
+// ErrNotSupported is returned by backends for operations they can not perform
+var ErrNotSupported = errors.New("kv: operation not supported by backend")
+
+// NotFoundError is returned by Type for keys that do not exist
+type NotFoundError struct {
+	Key string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("key %s not found", e.Key)
+}
+
+// ReconnectError is returned by backends that lost their connection, they
+// try to connect again on the first operation after At
+type ReconnectError struct {
+	Err error
+	At  time.Time
+}
+
+func (e *ReconnectError) Error() string {
+	return fmt.Sprintf("%v, reconnecting in %s", e.Err, e.In())
+}
+
+// In returns the time left until reconnecting, rounded up to seconds
+func (e *ReconnectError) In() time.Duration {
+	d := e.At.Sub(time.Now())
+	if d <= 0 {
+		return 0
+	}
+	return (d + time.Second - 1) / time.Second * time.Second
+}
+
+// Factory creates a KV-store from the given connection parameters
+type Factory func(params string) (KV, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Factory)
+)
+
+// Register makes a KV-storage driver available by the provided name.
+// It is meant to be called from the init function of a backend package.
+// If Register is called twice with the same name or if factory is nil,
+// it panics.
+func Register(name string, factory Factory) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if factory == nil {
+		panic("kv: Register factory is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("kv: Register called twice for driver " + name)
+	}
+	drivers[name] = factory
+}
+
+// Drivers returns a sorted list of the names of the registered drivers
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	list := make([]string, 0, len(drivers))
+	for name := range drivers {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// UnknownDriverError is returned by New when no driver is registered
+// with the requested name
+type UnknownDriverError struct {
+	Name string
+}
+
+func (e *UnknownDriverError) Error() string {
+	return fmt.Sprintf("kv: unknown driver %q (forgotten import?)", e.Name)
+}
+
 // New initializes a new KV-store
 func New(t string, params string) (KV, error) {
-	switch t {
-	case TypeRedis:
-		return rediskv.New(params)
-		//	case TypeRAM:
-		//		return ramkv.New()
-	default:
-		panic("invalid KV-storage")
+	driversMu.RLock()
+	factory, ok := drivers[t]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, &UnknownDriverError{Name: t}
 	}
+	return factory(params)
 }
@@ -1,9 +1,11 @@
-package kv
+package kv_test
 
 import (
 	"net"
 	"testing"
 
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/ramkv"
 	"github.com/rikvdh/kvui/kv/rediskv"
 )
 
@@ -14,7 +16,7 @@ func TestKvRedis(t *testing.T) {
 	}
 	defer l.Close()
 
-	r, err := New(TypeRedis, "127.0.0.1:56789")
+	r, err := kv.New(kv.TypeRedis, "127.0.0.1:56789")
 	if err != nil {
 		t.Error("Error must not be nil")
 	}
@@ -23,21 +25,50 @@ func TestKvRedis(t *testing.T) {
 	}
 }
 
-/*func TestKvRAM(t *testing.T) {
-	r, err := New(TypeRAM, "")
+func TestKvRAM(t *testing.T) {
+	r, err := kv.New(kv.TypeRAM, "")
 	if err != nil {
 		t.Error("Error must not be nil")
 	}
 	if _, ok := r.(*ramkv.Ramkv); !ok {
-		t.Error("Reply must be a rediskv")
+		t.Error("Reply must be a ramkv")
 	}
-}*/
+}
 
 func TestInvalidKV(t *testing.T) {
+	r, err := kv.New("boem", "")
+	if err == nil {
+		t.Error("Error expected for unknown driver")
+	}
+	if e, ok := err.(*kv.UnknownDriverError); !ok || e.Name != "boem" {
+		t.Errorf("Expected UnknownDriverError, got: %v", err)
+	}
+	if r != nil {
+		t.Error("Reply must be nil")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	kv.Register("dummy", func(params string) (kv.KV, error) {
+		return nil, nil
+	})
+
+	found := false
+	for _, d := range kv.Drivers() {
+		if d == "dummy" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Registered driver must be listed by Drivers")
+	}
+
 	defer func() {
 		if r := recover(); r == nil {
-			t.Error("The code dit not panic")
+			t.Error("The code did not panic on duplicate register")
 		}
 	}()
-	New("boem", "")
+	kv.Register("dummy", func(params string) (kv.KV, error) {
+		return nil, nil
+	})
 }
@@ -0,0 +1,611 @@
+package memcachedkv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/glob"
+	"github.com/rikvdh/kvui/kv/types"
+)
+
+func init() {
+	kv.Register(kv.TypeMemcached, func(params string) (kv.KV, error) {
+		return New(params)
+	})
+}
+
+// Memcachedkv stores the values that is set or retrieved in Memcached,
+// it speaks the memcached text protocol over a single connection
+type Memcachedkv struct {
+	lock sync.Mutex
+	conn net.Conn
+	rw   *bufio.ReadWriter
+	err  error
+
+	// scanKeys holds the keys dumped at the start of a Scan iteration by
+	// pattern, it is guarded by lock
+	scanKeys map[string][]string
+}
+
+// serverError is an error reply (ERROR, CLIENT_ERROR or SERVER_ERROR) from memcached
+type serverError string
+
+func (e serverError) Error() string {
+	return "memcached: " + string(e)
+}
+
+func isErrorReply(line string) bool {
+	return line == "ERROR" || strings.HasPrefix(line, "CLIENT_ERROR") || strings.HasPrefix(line, "SERVER_ERROR")
+}
+
+func checkKey(key string) error {
+	if len(key) == 0 || len(key) > 250 {
+		return fmt.Errorf("invalid key length: %d", len(key))
+	}
+	for _, c := range key {
+		if c <= ' ' || c == 0x7f {
+			return fmt.Errorf("invalid key: %q", key)
+		}
+	}
+	return nil
+}
+
+// fatal records a connection error, the connection is unusable afterwards
+func (m *Memcachedkv) fatal(err error) error {
+	if m.err == nil {
+		m.err = err
+		m.conn.Close()
+	}
+	return err
+}
+
+// roundTrip sends cmd (and the optional data block) and lets fn parse the
+// reply. The deadline of ctx is applied as read/write deadline and
+// canceling ctx aborts a pending read or write.
+func (m *Memcachedkv) roundTrip(ctx context.Context, cmd string, data []byte, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+
+	deadline, _ := ctx.Deadline()
+	if err := m.conn.SetDeadline(deadline); err != nil {
+		return m.fatal(err)
+	}
+	if done := ctx.Done(); done != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-done:
+				m.conn.SetDeadline(time.Now())
+			case <-stop:
+			}
+		}()
+	}
+
+	if _, err := m.rw.WriteString(cmd + "\r\n"); err != nil {
+		return m.fatal(err)
+	}
+	if data != nil {
+		m.rw.Write(data)
+		if _, err := m.rw.WriteString("\r\n"); err != nil {
+			return m.fatal(err)
+		}
+	}
+	if err := m.rw.Flush(); err != nil {
+		return m.fatal(err)
+	}
+	return fn()
+}
+
+// readLine reads a single reply line without the trailing CRLF
+func (m *Memcachedkv) readLine() (string, error) {
+	line, err := m.rw.ReadString('\n')
+	if err != nil {
+		return "", m.fatal(err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readLines reads reply lines up to (not including) the END line
+func (m *Memcachedkv) readLines() ([]string, error) {
+	var lines []string
+	for {
+		line, err := m.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "END" {
+			return lines, nil
+		}
+		if isErrorReply(line) {
+			return nil, serverError(line)
+		}
+		lines = append(lines, line)
+	}
+}
+
+// Get returns the value from the requested key.
+func (m *Memcachedkv) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	var value []byte
+	found := false
+	err := m.roundTrip(ctx, "get "+key, nil, func() error {
+		for {
+			line, err := m.readLine()
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			if isErrorReply(line) {
+				return serverError(line)
+			}
+			// VALUE <key> <flags> <bytes> [<cas unique>]
+			f := strings.Fields(line)
+			if len(f) < 4 || f[0] != "VALUE" {
+				return m.fatal(fmt.Errorf("memcached: unexpected reply: %q", line))
+			}
+			n, err := strconv.Atoi(f[3])
+			if err != nil {
+				return m.fatal(err)
+			}
+			buf := make([]byte, n+2)
+			if _, err := io.ReadFull(m.rw, buf); err != nil {
+				return m.fatal(err)
+			}
+			if !bytes.HasSuffix(buf, []byte("\r\n")) {
+				return m.fatal(fmt.Errorf("memcached: bad data block terminator"))
+			}
+			value = buf[:n]
+			found = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, &kv.NotFoundError{Key: key}
+	}
+	return value, nil
+}
+
+// Set stores the value with the given key, without expiration
+func (m *Memcachedkv) Set(ctx context.Context, key string, value interface{}) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		data = []byte(fmt.Sprintf("%v", value))
+	}
+	return m.roundTrip(ctx, fmt.Sprintf("set %s 0 0 %d", key, len(data)), data, func() error {
+		line, err := m.readLine()
+		if err != nil {
+			return err
+		}
+		if line != "STORED" {
+			return serverError(line)
+		}
+		return nil
+	})
+}
+
+// Del removes the value with the given key
+func (m *Memcachedkv) Del(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return m.roundTrip(ctx, "delete "+key, nil, func() error {
+		line, err := m.readLine()
+		if err != nil {
+			return err
+		}
+		if line != "DELETED" && line != "NOT_FOUND" {
+			return serverError(line)
+		}
+		return nil
+	})
+}
+
+// metadump lists all keys using 'lru_crawler metadump all' (memcached >= 1.4.31)
+func (m *Memcachedkv) metadump(ctx context.Context) ([]string, error) {
+	var keys []string
+	err := m.roundTrip(ctx, "lru_crawler metadump all", nil, func() error {
+		lines, err := m.readLines()
+		if err != nil {
+			return err
+		}
+		for _, l := range lines {
+			// key=<urlencoded key> exp=... la=... cas=... fetch=... cls=... size=...
+			f := strings.Fields(l)
+			if len(f) == 0 || !strings.HasPrefix(f[0], "key=") {
+				continue
+			}
+			k, err := url.QueryUnescape(f[0][len("key="):])
+			if err != nil {
+				continue
+			}
+			keys = append(keys, k)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// cachedump lists keys using 'stats cachedump' for every slab class,
+// this is limited by the server to roughly 2MB of keys per slab class
+func (m *Memcachedkv) cachedump(ctx context.Context) ([]string, error) {
+	var slabs []string
+	err := m.roundTrip(ctx, "stats items", nil, func() error {
+		lines, err := m.readLines()
+		if err != nil {
+			return err
+		}
+		for _, l := range lines {
+			// STAT items:<slab>:number <count>
+			f := strings.Fields(l)
+			if len(f) != 3 || !strings.HasSuffix(f[1], ":number") {
+				continue
+			}
+			parts := strings.Split(f[1], ":")
+			if len(parts) == 3 {
+				slabs = append(slabs, parts[1])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, slab := range slabs {
+		err := m.roundTrip(ctx, "stats cachedump "+slab+" 0", nil, func() error {
+			lines, err := m.readLines()
+			if err != nil {
+				return err
+			}
+			for _, l := range lines {
+				// ITEM <key> [<size> b; <expiry> s]
+				f := strings.Fields(l)
+				if len(f) >= 2 && f[0] == "ITEM" {
+					keys = append(keys, f[1])
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// Keys returns a list of keys matched by pattern
+func (m *Memcachedkv) Keys(ctx context.Context, pattern string) ([]string, error) {
+	all, err := m.metadump(ctx)
+	if _, ok := err.(serverError); ok {
+		all, err = m.cachedump(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, k := range all {
+		if glob.Match(pattern, k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+// Scan returns a page of at most count keys matched by pattern. Memcached
+// can only dump all keys at once, so the dump is taken when cursor is 0
+// and the following pages are served from it. Each pattern has its own
+// dump, so iterations with different patterns don't mix.
+func (m *Memcachedkv) Scan(ctx context.Context, cursor uint64, pattern string, count int) (uint64, []string, error) {
+	m.lock.Lock()
+	keys, ok := m.scanKeys[pattern]
+	m.lock.Unlock()
+	if cursor == 0 || !ok {
+		var err error
+		if keys, err = m.Keys(ctx, pattern); err != nil {
+			return 0, nil, err
+		}
+		sort.Strings(keys)
+	}
+	next, page := kv.ScanSlice(keys, cursor, count)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.scanKeys == nil {
+		m.scanKeys = make(map[string][]string)
+	}
+	if next == 0 {
+		delete(m.scanKeys, pattern)
+	} else {
+		m.scanKeys[pattern] = keys
+	}
+	return next, page, nil
+}
+
+// HKeys is not supported, memcached has no hashes
+func (m *Memcachedkv) HKeys(ctx context.Context, key string) ([]string, error) {
+	return nil, kv.ErrNotSupported
+}
+
+// HScan is not supported, memcached has no hashes
+func (m *Memcachedkv) HScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []string, error) {
+	return 0, nil, kv.ErrNotSupported
+}
+
+// HGet is not supported, memcached has no hashes
+func (m *Memcachedkv) HGet(ctx context.Context, key, field string) ([]byte, error) {
+	return nil, kv.ErrNotSupported
+}
+
+// HSet is not supported, memcached has no hashes
+func (m *Memcachedkv) HSet(ctx context.Context, key, field string, value interface{}) error {
+	return kv.ErrNotSupported
+}
+
+// HDel is not supported, memcached has no hashes
+func (m *Memcachedkv) HDel(ctx context.Context, key, field string) error {
+	return kv.ErrNotSupported
+}
+
+// LGet is not supported, memcached has no lists
+func (m *Memcachedkv) LGet(ctx context.Context, key string) ([]string, error) {
+	return nil, kv.ErrNotSupported
+}
+
+// LRange is not supported, memcached has no lists
+func (m *Memcachedkv) LRange(ctx context.Context, key string, offset, count int) ([]string, error) {
+	return nil, kv.ErrNotSupported
+}
+
+// RPush is not supported, memcached has no lists
+func (m *Memcachedkv) RPush(ctx context.Context, key string, values ...interface{}) error {
+	return kv.ErrNotSupported
+}
+
+// SMembers is not supported, memcached has no sets
+func (m *Memcachedkv) SMembers(ctx context.Context, key string) ([]string, error) {
+	return nil, kv.ErrNotSupported
+}
+
+// SScan is not supported, memcached has no sets
+func (m *Memcachedkv) SScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []string, error) {
+	return 0, nil, kv.ErrNotSupported
+}
+
+// ZScan is not supported, memcached has no sorted sets
+func (m *Memcachedkv) ZScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []kv.Z, error) {
+	return 0, nil, kv.ErrNotSupported
+}
+
+// Len is not supported, memcached only stores strings
+func (m *Memcachedkv) Len(ctx context.Context, key string) (int, error) {
+	return 0, kv.ErrNotSupported
+}
+
+// ZRangeWithScores is not supported, memcached has no sorted sets
+func (m *Memcachedkv) ZRangeWithScores(ctx context.Context, key string, start, stop int) ([]kv.Z, error) {
+	return nil, kv.ErrNotSupported
+}
+
+// SAdd is not supported, memcached has no sets
+func (m *Memcachedkv) SAdd(ctx context.Context, key string, members ...interface{}) error {
+	return kv.ErrNotSupported
+}
+
+// ZAdd is not supported, memcached has no sorted sets
+func (m *Memcachedkv) ZAdd(ctx context.Context, key string, members ...kv.Z) error {
+	return kv.ErrNotSupported
+}
+
+// maxRelative is the largest expiration time memcached takes as seconds
+// from now, larger ones are taken as unix time
+const maxRelative = 30 * 24 * 60 * 60
+
+// expiration returns the expiration time memcached takes for ttl, at least
+// a second from now
+func expiration(ttl time.Duration) int64 {
+	secs := int64(ttl / time.Second)
+	if secs < 1 {
+		return 1
+	}
+	if secs > maxRelative {
+		return time.Now().Add(ttl).Unix()
+	}
+	return secs
+}
+
+// Expire sets the expiration time of key, memcached takes the time in
+// whole seconds
+func (m *Memcachedkv) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return m.touch(ctx, key, expiration(ttl))
+}
+
+// Persist removes the expiration of key
+func (m *Memcachedkv) Persist(ctx context.Context, key string) error {
+	return m.touch(ctx, key, 0)
+}
+
+// touch sets the expiration time of key in seconds, 0 never expires
+func (m *Memcachedkv) touch(ctx context.Context, key string, secs int64) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return m.roundTrip(ctx, fmt.Sprintf("touch %s %d", key, secs), nil, func() error {
+		line, err := m.readLine()
+		if err != nil {
+			return err
+		}
+		switch line {
+		case "TOUCHED":
+			return nil
+		case "NOT_FOUND":
+			return fmt.Errorf("key %s not found", key)
+		}
+		return serverError(line)
+	})
+}
+
+// TTL is not supported, memcached does not tell the expiration time
+func (m *Memcachedkv) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return 0, kv.ErrNotSupported
+}
+
+// Dump returns the raw value stored at key
+func (m *Memcachedkv) Dump(ctx context.Context, key string) ([]byte, error) {
+	return m.Get(ctx, key)
+}
+
+// Restore stores data at key using 'add', so an existing key is not
+// overwritten
+func (m *Memcachedkv) Restore(ctx context.Context, key string, ttl time.Duration, data []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	var secs int64
+	if ttl > 0 {
+		secs = expiration(ttl)
+	}
+	return m.roundTrip(ctx, fmt.Sprintf("add %s 0 %d %d", key, secs, len(data)), data, func() error {
+		line, err := m.readLine()
+		if err != nil {
+			return err
+		}
+		switch line {
+		case "STORED":
+			return nil
+		case "NOT_STORED":
+			return fmt.Errorf("key %s already exists", key)
+		}
+		return serverError(line)
+	})
+}
+
+// Databases is always 1 for memcached
+func (m *Memcachedkv) Databases(ctx context.Context) (int, error) {
+	return 1, nil
+}
+
+// Database only accepts database 0
+func (m *Memcachedkv) Database(ctx context.Context, db int) error {
+	if db != 0 {
+		return fmt.Errorf("invalid database: %d", db)
+	}
+	return nil
+}
+
+// DatabaseName returns the name of the single database
+func (m *Memcachedkv) DatabaseName(ctx context.Context, db int) (string, error) {
+	if db != 0 {
+		return "", fmt.Errorf("invalid database: %d", db)
+	}
+	return "0", nil
+}
+
+// Connected reports whether the connection is still healthy
+func (m *Memcachedkv) Connected(ctx context.Context) (bool, error) {
+	m.lock.Lock()
+	err := m.err
+	m.lock.Unlock()
+	return err == nil, err
+}
+
+// Type returns KVTypeString for every existing key
+func (m *Memcachedkv) Type(ctx context.Context, key string) (types.KVType, error) {
+	found, err := m.exists(ctx, key)
+	if _, ok := err.(serverError); ok {
+		// memcached before 1.6 has no meta commands
+		if _, err := m.Get(ctx, key); err != nil {
+			return types.KVTypeInvalid, err
+		}
+		return types.KVTypeString, nil
+	}
+	if err != nil {
+		return types.KVTypeInvalid, err
+	}
+	if !found {
+		return types.KVTypeInvalid, &kv.NotFoundError{Key: key}
+	}
+	return types.KVTypeString, nil
+}
+
+// exists reports whether key exists using 'mg' without flags, which does
+// not fetch the value (memcached >= 1.6)
+func (m *Memcachedkv) exists(ctx context.Context, key string) (bool, error) {
+	if err := checkKey(key); err != nil {
+		return false, err
+	}
+	found := false
+	err := m.roundTrip(ctx, "mg "+key, nil, func() error {
+		line, err := m.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "HD" || line == "OK":
+			// OK is the hit of memcached before 1.6.10
+			found = true
+			return nil
+		case line == "EN":
+			return nil
+		case isErrorReply(line):
+			return serverError(line)
+		}
+		return m.fatal(fmt.Errorf("memcached: unexpected reply: %q", line))
+	})
+	return found, err
+}
+
+// Close closes the connection
+func (m *Memcachedkv) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.err == nil {
+		m.err = fmt.Errorf("connection closed")
+	}
+	return m.conn.Close()
+}
+
+// New creates a Memcached key value instance
+func New(host string) (*Memcachedkv, error) {
+	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &Memcachedkv{
+		conn: conn,
+		rw:   bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+	}, nil
+}
@@ -0,0 +1,325 @@
+package memcachedkv
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+// memcachedMock is a tiny in-process memcached speaking the text protocol
+type memcachedMock struct {
+	l     net.Listener
+	lock  sync.Mutex
+	items map[string]string
+	// noMetadump makes it an old memcached, without metadump and meta
+	// commands
+	noMetadump bool
+	// gets counts the get commands
+	gets int
+}
+
+func newMemcachedMock(t *testing.T) *memcachedMock {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &memcachedMock{l: l, items: make(map[string]string)}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(c)
+		}
+	}()
+	return m
+}
+
+func (m *memcachedMock) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			fmt.Fprint(c, "ERROR\r\n")
+			continue
+		}
+		m.lock.Lock()
+		switch f[0] {
+		case "get":
+			m.gets++
+			if v, ok := m.items[f[1]]; ok {
+				fmt.Fprintf(c, "VALUE %s 0 %d\r\n%s\r\n", f[1], len(v), v)
+			}
+			fmt.Fprint(c, "END\r\n")
+		case "set":
+			n, _ := strconv.Atoi(f[4])
+			buf := make([]byte, n+2)
+			io.ReadFull(r, buf)
+			m.items[f[1]] = string(buf[:n])
+			fmt.Fprint(c, "STORED\r\n")
+		case "add":
+			n, _ := strconv.Atoi(f[4])
+			buf := make([]byte, n+2)
+			io.ReadFull(r, buf)
+			if _, ok := m.items[f[1]]; ok {
+				fmt.Fprint(c, "NOT_STORED\r\n")
+			} else {
+				m.items[f[1]] = string(buf[:n])
+				fmt.Fprint(c, "STORED\r\n")
+			}
+		case "delete":
+			if _, ok := m.items[f[1]]; ok {
+				delete(m.items, f[1])
+				fmt.Fprint(c, "DELETED\r\n")
+			} else {
+				fmt.Fprint(c, "NOT_FOUND\r\n")
+			}
+		case "mg":
+			if m.noMetadump {
+				fmt.Fprint(c, "ERROR\r\n")
+			} else if _, ok := m.items[f[1]]; ok {
+				fmt.Fprint(c, "HD\r\n")
+			} else {
+				fmt.Fprint(c, "EN\r\n")
+			}
+		case "touch":
+			if _, ok := m.items[f[1]]; ok {
+				fmt.Fprint(c, "TOUCHED\r\n")
+			} else {
+				fmt.Fprint(c, "NOT_FOUND\r\n")
+			}
+		case "lru_crawler":
+			if m.noMetadump {
+				fmt.Fprint(c, "ERROR\r\n")
+				break
+			}
+			for k, v := range m.items {
+				fmt.Fprintf(c, "key=%s exp=-1 la=0 cas=1 fetch=no cls=1 size=%d\r\n", url.QueryEscape(k), len(v))
+			}
+			fmt.Fprint(c, "END\r\n")
+		case "stats":
+			if len(f) > 1 && f[1] == "items" {
+				fmt.Fprintf(c, "STAT items:1:number %d\r\nSTAT items:1:age 10\r\n", len(m.items))
+			} else if len(f) > 2 && f[1] == "cachedump" && f[2] == "1" {
+				for k, v := range m.items {
+					fmt.Fprintf(c, "ITEM %s [%d b; 0 s]\r\n", k, len(v))
+				}
+			}
+			fmt.Fprint(c, "END\r\n")
+		default:
+			fmt.Fprint(c, "ERROR\r\n")
+		}
+		m.lock.Unlock()
+	}
+}
+
+func TestGetSetDel(t *testing.T) {
+	mock := newMemcachedMock(t)
+	defer mock.l.Close()
+
+	kvStorage, err := New(mock.l.Addr().String())
+	assert.Nil(t, err)
+	defer kvStorage.Close()
+
+	_, err = kvStorage.Get(ctx, "value")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, kvStorage.Set(ctx, "value", "line one\r\nline two"))
+	value, err := kvStorage.Get(ctx, "value")
+	assert.Nil(t, err)
+	assert.Equal(t, "line one\r\nline two", string(value))
+
+	assert.Nil(t, kvStorage.Set(ctx, "number", 42))
+	value, err = kvStorage.Get(ctx, "number")
+	assert.Nil(t, err)
+	assert.Equal(t, "42", string(value))
+
+	tp, err := kvStorage.Type(ctx, "number")
+	assert.Nil(t, err)
+	assert.Equal(t, types.KVTypeString, tp)
+
+	assert.Implements(t, (*kv.Dumper)(nil), kvStorage)
+	data, err := kvStorage.Dump(ctx, "number")
+	assert.Nil(t, err)
+	assert.NotNil(t, kvStorage.Restore(ctx, "number", 0, data))
+
+	assert.Nil(t, kvStorage.Del(ctx, "number"))
+	assert.Nil(t, kvStorage.Del(ctx, "number"))
+	assert.Nil(t, kvStorage.Restore(ctx, "number", 0, data))
+	value, err = kvStorage.Get(ctx, "number")
+	assert.Nil(t, err)
+	assert.Equal(t, "42", string(value))
+	assert.Nil(t, kvStorage.Del(ctx, "number"))
+	_, err = kvStorage.Type(ctx, "number")
+	assert.IsType(t, &kv.NotFoundError{}, err)
+
+	assert.NotNil(t, kvStorage.Set(ctx, "with space", "x"))
+
+	assert.Nil(t, kvStorage.Expire(ctx, "value", time.Minute))
+	assert.NotNil(t, kvStorage.Expire(ctx, "missing", time.Minute))
+	assert.Nil(t, kvStorage.Persist(ctx, "value"))
+
+	con, err := kvStorage.Connected(ctx)
+	assert.True(t, con)
+	assert.Nil(t, err)
+}
+
+func TestKeys(t *testing.T) {
+	mock := newMemcachedMock(t)
+	defer mock.l.Close()
+
+	kvStorage, err := New(mock.l.Addr().String())
+	assert.Nil(t, err)
+	defer kvStorage.Close()
+
+	kvStorage.Set(ctx, "user:1", "rik")
+	kvStorage.Set(ctx, "user:2", "bats")
+	kvStorage.Set(ctx, "session:1", "boem")
+
+	keys, err := kvStorage.Keys(ctx, "user:*")
+	assert.Nil(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"user:1", "user:2"}, keys)
+
+	mock.lock.Lock()
+	mock.noMetadump = true
+	mock.lock.Unlock()
+
+	keys, err = kvStorage.Keys(ctx, "*")
+	assert.Nil(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"session:1", "user:1", "user:2"}, keys)
+}
+
+func TestScan(t *testing.T) {
+	mock := newMemcachedMock(t)
+	defer mock.l.Close()
+
+	kvStorage, err := New(mock.l.Addr().String())
+	assert.Nil(t, err)
+	defer kvStorage.Close()
+
+	kvStorage.Set(ctx, "user:1", "rik")
+	kvStorage.Set(ctx, "user:2", "bats")
+	kvStorage.Set(ctx, "session:1", "boem")
+	kvStorage.Set(ctx, "session:2", "boem")
+
+	// iterations with different patterns interleave
+	users, sessions := []string{}, []string{}
+	ucur, page, err := kvStorage.Scan(ctx, 0, "user:*", 1)
+	assert.Nil(t, err)
+	users = append(users, page...)
+	scur, page, err := kvStorage.Scan(ctx, 0, "session:*", 1)
+	assert.Nil(t, err)
+	sessions = append(sessions, page...)
+	for ucur != 0 || scur != 0 {
+		if ucur != 0 {
+			ucur, page, err = kvStorage.Scan(ctx, ucur, "user:*", 1)
+			assert.Nil(t, err)
+			users = append(users, page...)
+		}
+		if scur != 0 {
+			scur, page, err = kvStorage.Scan(ctx, scur, "session:*", 1)
+			assert.Nil(t, err)
+			sessions = append(sessions, page...)
+		}
+	}
+	assert.Equal(t, []string{"user:1", "user:2"}, users)
+	assert.Equal(t, []string{"session:1", "session:2"}, sessions)
+}
+
+func TestUnsupported(t *testing.T) {
+	mock := newMemcachedMock(t)
+	defer mock.l.Close()
+
+	kvStorage, err := New(mock.l.Addr().String())
+	assert.Nil(t, err)
+	defer kvStorage.Close()
+
+	_, err = kvStorage.HKeys(ctx, "value")
+	assert.Equal(t, kv.ErrNotSupported, err)
+	_, err = kvStorage.LGet(ctx, "value")
+	assert.Equal(t, kv.ErrNotSupported, err)
+
+	n, err := kvStorage.Databases(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.NotNil(t, kvStorage.Database(ctx, 1))
+}
+
+func TestConnectionLost(t *testing.T) {
+	mock := newMemcachedMock(t)
+
+	kvStorage, err := New(mock.l.Addr().String())
+	assert.Nil(t, err)
+
+	mock.l.Close()
+	kvStorage.conn.Close()
+
+	_, err = kvStorage.Get(ctx, "value")
+	assert.NotNil(t, err)
+
+	con, err := kvStorage.Connected(ctx)
+	assert.False(t, con)
+	assert.NotNil(t, err)
+}
+
+func TestExpiration(t *testing.T) {
+	assert.Equal(t, int64(1), expiration(time.Millisecond))
+	assert.Equal(t, int64(3600), expiration(time.Hour))
+	assert.Equal(t, int64(maxRelative), expiration(maxRelative*time.Second))
+
+	// longer TTLs are sent as unix time, memcached takes them as such
+	ttl := 31 * 24 * time.Hour
+	exp := expiration(ttl)
+	assert.InDelta(t, time.Now().Add(ttl).Unix(), exp, 2)
+}
+
+func TestType(t *testing.T) {
+	mock := newMemcachedMock(t)
+	defer mock.l.Close()
+
+	kvStorage, err := New(mock.l.Addr().String())
+	assert.Nil(t, err)
+	defer kvStorage.Close()
+	kvStorage.Set(ctx, "number", 42)
+
+	// the value is not fetched to tell the type
+	tp, err := kvStorage.Type(ctx, "number")
+	assert.Nil(t, err)
+	assert.Equal(t, types.KVTypeString, tp)
+	_, err = kvStorage.Type(ctx, "missing")
+	assert.IsType(t, &kv.NotFoundError{}, err)
+	mock.lock.Lock()
+	assert.Equal(t, 0, mock.gets)
+	mock.noMetadump = true
+	mock.lock.Unlock()
+
+	// servers without meta commands
+	tp, err = kvStorage.Type(ctx, "number")
+	assert.Nil(t, err)
+	assert.Equal(t, types.KVTypeString, tp)
+	_, err = kvStorage.Type(ctx, "missing")
+	assert.IsType(t, &kv.NotFoundError{}, err)
+}
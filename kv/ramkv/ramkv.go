@@ -1,144 +1,623 @@
 package ramkv
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"encoding/gob"
 	"fmt"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
+
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/glob"
+	"github.com/rikvdh/kvui/kv/types"
 )
 
+// DefaultDatabases is the number of databases a new Ramkv has
+const DefaultDatabases = 16
+
+func init() {
+	kv.Register(kv.TypeRAM, func(params string) (kv.KV, error) {
+		return New()
+	})
+}
+
+// entry is a single value stored in RAM
+type entry struct {
+	t       types.KVType
+	str     string
+	hash    map[string]string
+	list    []string
+	set     map[string]struct{}
+	zset    map[string]float64
+	expires time.Time
+}
+
+// expired reports whether the expiration time of e has passed
+func (e *entry) expired() bool {
+	return !e.expires.IsZero() && !time.Now().Before(e.expires)
+}
+
 // Ramkv stores the values that is set or retrieved in RAM
 type Ramkv struct {
 	lock    sync.RWMutex
-	storage map[string]map[string]string
+	db      int
+	storage []map[string]*entry
 }
 
-// Get returns the value from the requested key.
-func (r *Ramkv) Get(key string) (string, error) {
-	r.lock.RLock()
-	value, found := r.storage[key]
-	r.lock.RUnlock()
-	if found && value != nil {
-		value, err := json.Marshal(value)
-		if err != nil {
-			return "", err
-		}
-		return string(value), nil
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
 	}
-	return "", fmt.Errorf("key %s not found", key)
+	return fmt.Sprintf("%v", value)
 }
 
-// Set stores the value with the given key
-func (r *Ramkv) Set(key string, value interface{}) error {
-	r.lock.Lock()
-	if r.storage[key] == nil {
-		r.storage[key] = make(map[string]string)
+func wrongType(key string) error {
+	return fmt.Errorf("key %s holds the wrong kind of value", key)
+}
+
+// noValues is returned by adds without values, like Redis there are no
+// empty lists, sets or sorted sets
+func noValues(key string) error {
+	return fmt.Errorf("nothing to add to %s", key)
+}
+
+// find returns the entry for key in the selected database, expired
+// entries are not found. The lock must be held.
+func (r *Ramkv) find(key string) (*entry, bool) {
+	e, found := r.storage[r.db][key]
+	if !found || e.expired() {
+		return nil, false
 	}
-	r.lock.Unlock()
+	return e, true
+}
 
-	if strValue, ok := value.(string); ok {
-		var jsonValue map[string]string
-		err := json.Unmarshal([]byte(strValue), &jsonValue)
-		if err != nil {
-			return err
-		}
-		r.lock.Lock()
-		r.storage[key] = jsonValue
-		r.lock.Unlock()
+// lookup returns the entry for key in the selected database, the lock must be held
+func (r *Ramkv) lookup(key string, t types.KVType) (*entry, error) {
+	e, found := r.find(key)
+	if !found {
+		return nil, fmt.Errorf("key %s not found", key)
+	}
+	if e.t != t {
+		return nil, wrongType(key)
 	}
+	return e, nil
+}
+
+// Get returns the value from the requested key.
+func (r *Ramkv) Get(ctx context.Context, key string) ([]byte, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, err := r.lookup(key, types.KVTypeString)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(e.str), nil
+}
 
+// Set stores the value with the given key, any existing value is replaced
+func (r *Ramkv) Set(ctx context.Context, key string, value interface{}) error {
+	r.lock.Lock()
+	r.storage[r.db][key] = &entry{t: types.KVTypeString, str: toString(value)}
+	r.lock.Unlock()
 	return nil
 }
 
 // Del removes the value with the given key
-func (r *Ramkv) Del(key string) error {
+func (r *Ramkv) Del(ctx context.Context, key string) error {
 	r.lock.Lock()
-	delete(r.storage, key)
+	delete(r.storage[r.db], key)
 	r.lock.Unlock()
 	return nil
 }
 
-// Keys returns a list of all keys, pattern is ignored
-func (r *Ramkv) Keys(pattern string) ([]string, error) {
+// Keys returns a sorted list of keys matched by pattern
+func (r *Ramkv) Keys(ctx context.Context, pattern string) ([]string, error) {
 	var keys []string
 
 	r.lock.RLock()
-	for k := range r.storage {
-		keys = append(keys, k)
+	for k, e := range r.storage[r.db] {
+		if !e.expired() && glob.Match(pattern, k) {
+			keys = append(keys, k)
+		}
 	}
 	r.lock.RUnlock()
 
+	sort.Strings(keys)
 	return keys, nil
 }
 
+// Scan returns a page of at most count keys matched by pattern
+func (r *Ramkv) Scan(ctx context.Context, cursor uint64, pattern string, count int) (uint64, []string, error) {
+	keys, err := r.Keys(ctx, pattern)
+	if err != nil {
+		return 0, nil, err
+	}
+	next, page := kv.ScanSlice(keys, cursor, count)
+	return next, page, nil
+}
+
 // HKeys returns all keys in a hash
-func (r *Ramkv) HKeys(key string) ([]string, error) {
+func (r *Ramkv) HKeys(ctx context.Context, key string) ([]string, error) {
 	var keys []string
 
 	r.lock.RLock()
-	s, ok := r.storage[key]
-	r.lock.RUnlock()
-	if !ok {
-		return nil, fmt.Errorf("key %s not found", key)
+	defer r.lock.RUnlock()
+	e, err := r.lookup(key, types.KVTypeMap)
+	if err != nil {
+		return nil, err
 	}
-
-	for k := range s {
+	for k := range e.hash {
 		keys = append(keys, k)
 	}
 
+	sort.Strings(keys)
 	return keys, nil
 }
 
-// HGet retrieve the value from the given field in the given key
-func (r *Ramkv) HGet(key, field string) (string, error) {
+// HScan returns a page of at most count fields of a hash matched by
+// pattern
+func (r *Ramkv) HScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []string, error) {
 	r.lock.RLock()
-	if r.storage[key] == nil {
-		r.lock.RUnlock()
-		return "", fmt.Errorf("key %s not found", key)
+	defer r.lock.RUnlock()
+	e, err := r.lookup(key, types.KVTypeMap)
+	if err != nil {
+		return 0, nil, err
+	}
+	var fields []string
+	for f := range e.hash {
+		if glob.Match(pattern, f) {
+			fields = append(fields, f)
+		}
 	}
+	sort.Strings(fields)
+	next, page := kv.ScanSlice(fields, cursor, count)
+	return next, page, nil
+}
 
-	value, found := r.storage[key][field]
-	r.lock.RUnlock()
-	if found {
-		return value, nil
+// HGet retrieve the value from the given field in the given key
+func (r *Ramkv) HGet(ctx context.Context, key, field string) ([]byte, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, err := r.lookup(key, types.KVTypeMap)
+	if err != nil {
+		return nil, err
+	}
+	value, found := e.hash[field]
+	if !found {
+		return nil, fmt.Errorf("field %s not found", field)
 	}
-	return "", fmt.Errorf("field %s not found", field)
+	return []byte(value), nil
 }
 
 // HSet sets the value in the given field in the given key
-func (r *Ramkv) HSet(key, field string, value interface{}) error {
+func (r *Ramkv) HSet(ctx context.Context, key, field string, value interface{}) error {
 	r.lock.Lock()
-	if r.storage[key] == nil {
-		r.storage[key] = make(map[string]string)
+	defer r.lock.Unlock()
+	e, found := r.find(key)
+	if !found {
+		e = &entry{t: types.KVTypeMap, hash: make(map[string]string)}
+		r.storage[r.db][key] = e
+	} else if e.t != types.KVTypeMap {
+		return wrongType(key)
 	}
+	e.hash[field] = toString(value)
+	return nil
+}
 
-	r.storage[key][field] = fmt.Sprintf("%v", value)
-	r.lock.Unlock()
+// HDel removes the value in the given field in the given key,
+// the key is removed when the last field is gone
+func (r *Ramkv) HDel(ctx context.Context, key, field string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	e, found := r.find(key)
+	if !found {
+		return nil
+	}
+	if e.t != types.KVTypeMap {
+		return wrongType(key)
+	}
+	delete(e.hash, field)
+	if len(e.hash) == 0 {
+		delete(r.storage[r.db], key)
+	}
 	return nil
 }
 
-// HDel removes the value in the given field in the given key
-func (r *Ramkv) HDel(key, field string) error {
+// LGet returns all elements of a list
+func (r *Ramkv) LGet(ctx context.Context, key string) ([]string, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, err := r.lookup(key, types.KVTypeList)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]string, len(e.list))
+	copy(list, e.list)
+	return list, nil
+}
+
+// LRange returns at most count elements of a list starting at index offset
+func (r *Ramkv) LRange(ctx context.Context, key string, offset, count int) ([]string, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, err := r.lookup(key, types.KVTypeList)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset >= len(e.list) || count <= 0 {
+		return nil, nil
+	}
+	end := offset + count
+	if end > len(e.list) {
+		end = len(e.list)
+	}
+	list := make([]string, end-offset)
+	copy(list, e.list[offset:end])
+	return list, nil
+}
+
+// RPush appends values to the list stored at key, the list is created
+// when it does not exist
+func (r *Ramkv) RPush(ctx context.Context, key string, values ...interface{}) error {
+	if len(values) == 0 {
+		return noValues(key)
+	}
 	r.lock.Lock()
-	if r.storage[key] != nil {
-		delete(r.storage[key], field)
+	defer r.lock.Unlock()
+	e, found := r.find(key)
+	if !found {
+		e = &entry{t: types.KVTypeList}
+		r.storage[r.db][key] = e
+	} else if e.t != types.KVTypeList {
+		return wrongType(key)
+	}
+	for _, v := range values {
+		e.list = append(e.list, toString(v))
 	}
+	return nil
+}
+
+// SMembers returns the members of a set, sorted
+func (r *Ramkv) SMembers(ctx context.Context, key string) ([]string, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, err := r.lookup(key, types.KVTypeSet)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]string, 0, len(e.set))
+	for m := range e.set {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// SScan returns a page of at most count members of a set matched by
+// pattern
+func (r *Ramkv) SScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []string, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, err := r.lookup(key, types.KVTypeSet)
+	if err != nil {
+		return 0, nil, err
+	}
+	var members []string
+	for m := range e.set {
+		if glob.Match(pattern, m) {
+			members = append(members, m)
+		}
+	}
+	sort.Strings(members)
+	next, page := kv.ScanSlice(members, cursor, count)
+	return next, page, nil
+}
+
+// SAdd adds members to the set stored at key, the set is created when it
+// does not exist
+func (r *Ramkv) SAdd(ctx context.Context, key string, members ...interface{}) error {
+	if len(members) == 0 {
+		return noValues(key)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	e, found := r.find(key)
+	if !found {
+		e = &entry{t: types.KVTypeSet, set: make(map[string]struct{})}
+		r.storage[r.db][key] = e
+	} else if e.t != types.KVTypeSet {
+		return wrongType(key)
+	}
+	for _, m := range members {
+		e.set[toString(m)] = struct{}{}
+	}
+	return nil
+}
+
+// byScore sorts members of a sorted set by score, then by member
+type byScore []kv.Z
+
+func (b byScore) Len() int      { return len(b) }
+func (b byScore) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byScore) Less(i, j int) bool {
+	return b[i].Score < b[j].Score || b[i].Score == b[j].Score && b[i].Member < b[j].Member
+}
+
+// span returns the slice bounds for the range start up to and including
+// stop in a sequence of n elements, negative indexes count from the end
+func span(n, start, stop int) (int, int) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return 0, 0
+	}
+	return start, stop + 1
+}
+
+// ZRangeWithScores returns the members of a sorted set from index start up
+// to and including stop with their scores
+func (r *Ramkv) ZRangeWithScores(ctx context.Context, key string, start, stop int) ([]kv.Z, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, err := r.lookup(key, types.KVTypeSortedSet)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]kv.Z, 0, len(e.zset))
+	for m, score := range e.zset {
+		members = append(members, kv.Z{Score: score, Member: m})
+	}
+	sort.Sort(byScore(members))
+	lo, hi := span(len(members), start, stop)
+	return members[lo:hi], nil
+}
+
+// ZAdd adds members to the sorted set stored at key or updates their
+// score, the sorted set is created when it does not exist
+func (r *Ramkv) ZAdd(ctx context.Context, key string, members ...kv.Z) error {
+	if len(members) == 0 {
+		return noValues(key)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	e, found := r.find(key)
+	if !found {
+		e = &entry{t: types.KVTypeSortedSet, zset: make(map[string]float64)}
+		r.storage[r.db][key] = e
+	} else if e.t != types.KVTypeSortedSet {
+		return wrongType(key)
+	}
+	for _, z := range members {
+		e.zset[z.Member] = z.Score
+	}
+	return nil
+}
+
+// ZScan returns a page of at most count members of a sorted set matched by
+// pattern, ordered by score
+func (r *Ramkv) ZScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []kv.Z, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, err := r.lookup(key, types.KVTypeSortedSet)
+	if err != nil {
+		return 0, nil, err
+	}
+	var members []kv.Z
+	for m, score := range e.zset {
+		if glob.Match(pattern, m) {
+			members = append(members, kv.Z{Score: score, Member: m})
+		}
+	}
+	sort.Sort(byScore(members))
+	if count <= 0 {
+		count = kv.DefaultScanCount
+	}
+	if cursor >= uint64(len(members)) {
+		return 0, nil, nil
+	}
+	end := cursor + uint64(count)
+	if end >= uint64(len(members)) {
+		return 0, members[cursor:], nil
+	}
+	return end, members[cursor:end], nil
+}
+
+// Len returns the number of elements in the list, hash, set or sorted set
+// stored at key
+func (r *Ramkv) Len(ctx context.Context, key string) (int, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, found := r.find(key)
+	if !found {
+		return 0, fmt.Errorf("key %s not found", key)
+	}
+	switch e.t {
+	case types.KVTypeList:
+		return len(e.list), nil
+	case types.KVTypeMap:
+		return len(e.hash), nil
+	case types.KVTypeSet:
+		return len(e.set), nil
+	case types.KVTypeSortedSet:
+		return len(e.zset), nil
+	}
+	return 0, fmt.Errorf("%s is a %s, it has no elements", key, e.t)
+}
+
+// Expire sets a timeout on key, after which the key is removed
+func (r *Ramkv) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	e, found := r.find(key)
+	if !found {
+		return fmt.Errorf("key %s not found", key)
+	}
+	e.expires = time.Now().Add(ttl)
+	return nil
+}
+
+// TTL returns the time left before key expires, it is negative for keys
+// without expiration
+func (r *Ramkv) TTL(ctx context.Context, key string) (time.Duration, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, found := r.find(key)
+	if !found {
+		return 0, fmt.Errorf("key %s not found", key)
+	}
+	if e.expires.IsZero() {
+		return -1, nil
+	}
+	return e.expires.Sub(time.Now()), nil
+}
+
+// Persist removes the expiration of key
+func (r *Ramkv) Persist(ctx context.Context, key string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	e, found := r.find(key)
+	if !found {
+		return fmt.Errorf("key %s not found", key)
+	}
+	e.expires = time.Time{}
+	return nil
+}
+
+// dump is the serialized form of an entry
+type dump struct {
+	Type types.KVType
+	Str  string
+	Hash map[string]string
+	List []string
+	Set  []string
+	Zset map[string]float64
+}
+
+// Dump serializes the value stored at key
+func (r *Ramkv) Dump(ctx context.Context, key string) ([]byte, error) {
+	r.lock.RLock()
+	e, found := r.find(key)
+	if !found {
+		r.lock.RUnlock()
+		return nil, fmt.Errorf("key %s not found", key)
+	}
+	d := dump{Type: e.t, Str: e.str, Hash: e.hash, List: e.list, Zset: e.zset}
+	for m := range e.set {
+		d.Set = append(d.Set, m)
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(d)
+	r.lock.RUnlock()
+	return buf.Bytes(), err
+}
+
+// Restore creates key from data serialized by Dump, a ttl of zero or less
+// creates it without expiration
+func (r *Ramkv) Restore(ctx context.Context, key string, ttl time.Duration, data []byte) error {
+	var d dump
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&d); err != nil {
+		return err
+	}
+	e := &entry{t: d.Type, str: d.Str, hash: d.Hash, list: d.List, zset: d.Zset}
+	// gob leaves empty maps nil
+	switch d.Type {
+	case types.KVTypeMap:
+		if e.hash == nil {
+			e.hash = make(map[string]string)
+		}
+	case types.KVTypeSet:
+		e.set = make(map[string]struct{}, len(d.Set))
+		for _, m := range d.Set {
+			e.set[m] = struct{}{}
+		}
+	case types.KVTypeSortedSet:
+		if e.zset == nil {
+			e.zset = make(map[string]float64)
+		}
+	}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, found := r.find(key); found {
+		return fmt.Errorf("key %s already exists", key)
+	}
+	r.storage[r.db][key] = e
+	return nil
+}
+
+// Databases returns the number of databases
+func (r *Ramkv) Databases(ctx context.Context) (int, error) {
+	return len(r.storage), nil
+}
+
+// Database selects the database to use
+func (r *Ramkv) Database(ctx context.Context, db int) error {
+	if db < 0 || db >= len(r.storage) {
+		return fmt.Errorf("invalid database: %d", db)
+	}
+	r.lock.Lock()
+	r.db = db
 	r.lock.Unlock()
 	return nil
 }
 
-// Databases is always 1 for RAM
-func (*Ramkv) Databases() (int, error) {
-	return 1, nil
+// DatabaseName returns the name of a numbered database
+func (r *Ramkv) DatabaseName(ctx context.Context, db int) (string, error) {
+	if db < 0 || db >= len(r.storage) {
+		return "", fmt.Errorf("invalid database: %d", db)
+	}
+	return strconv.Itoa(db), nil
 }
 
 // Connected is always true for RAM
-func (*Ramkv) Connected() (bool, error) {
+func (*Ramkv) Connected(ctx context.Context) (bool, error) {
 	return true, nil
 }
 
-// New creates a Ram key value instance
+// Type returns the type of the value stored at key
+func (r *Ramkv) Type(ctx context.Context, key string) (types.KVType, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, found := r.find(key)
+	if !found {
+		return types.KVTypeInvalid, &kv.NotFoundError{Key: key}
+	}
+	return e.t, nil
+}
+
+// New creates a Ram key value instance with DefaultDatabases databases
 func New() (*Ramkv, error) {
+	return NewWithDatabases(DefaultDatabases)
+}
+
+// NewWithDatabases creates a Ram key value instance with n databases
+func NewWithDatabases(n int) (*Ramkv, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid number of databases: %d", n)
+	}
 	ramkv := Ramkv{}
-	ramkv.storage = make(map[string]map[string]string)
+	ramkv.storage = make([]map[string]*entry, n)
+	for i := range ramkv.storage {
+		ramkv.storage[i] = make(map[string]*entry)
+	}
 	return &ramkv, nil
 }
@@ -1,34 +1,41 @@
 package ramkv
 
 import (
-	"github.com/stretchr/testify/assert"
+	"context"
 	"testing"
+	"time"
+
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/types"
+	"github.com/stretchr/testify/assert"
 )
 
+var ctx = context.Background()
+
 func TestGetSet(t *testing.T) {
 	kvStorage, err := New()
 	assert.Nil(t, err)
 
-	value, err := kvStorage.Get("value")
+	value, err := kvStorage.Get(ctx, "value")
 	if err.Error() != "key value not found" {
 		t.Error("Expected error for ramkv.Get")
 	}
 
-	if value != "" {
+	if len(value) != 0 {
 		t.Error("Unexpected get value for uninitialized value")
 	}
 
-	err = kvStorage.Set("value", `{"name": "simulator", "value": "20"}`)
+	err = kvStorage.Set(ctx, "value", `{"name": "simulator", "value": "20"}`)
 	if err != nil {
 		t.Error("Couln't set value name:simulator, value:20")
 	}
 
-	value, err = kvStorage.Get("value")
+	value, err = kvStorage.Get(ctx, "value")
 	if err != nil {
 		t.Error("Couln't get value for initialized value")
 	}
 
-	if value != `{"name":"simulator","value":"20"}` {
+	if string(value) != `{"name": "simulator", "value": "20"}` {
 		t.Error("Unexpected get value for initialized value")
 	}
 }
@@ -37,25 +44,25 @@ func TestDel(t *testing.T) {
 	kvStorage, err := New()
 	assert.Nil(t, err)
 
-	err = kvStorage.Set("value", `{"name": "simulator", "value": "20"}`)
+	err = kvStorage.Set(ctx, "value", `{"name": "simulator", "value": "20"}`)
 	assert.Nil(t, err)
 
-	value, err := kvStorage.Get("value")
+	value, err := kvStorage.Get(ctx, "value")
 	assert.Nil(t, err)
 
-	if value != `{"name":"simulator","value":"20"}` {
+	if string(value) != `{"name": "simulator", "value": "20"}` {
 		t.Error("Unexpected get value for value")
 	}
 
-	err = kvStorage.Del("value")
+	err = kvStorage.Del(ctx, "value")
 	assert.Nil(t, err)
 
-	value, err = kvStorage.Get("value")
+	value, err = kvStorage.Get(ctx, "value")
 	if err == nil {
 		t.Error("error expected, no value should be present")
 	}
 
-	if value != "" {
+	if len(value) != 0 {
 		t.Error("Unexpected get value for removed value")
 	}
 }
@@ -64,43 +71,43 @@ func TestHGetHSet(t *testing.T) {
 	kvStorage, err := New()
 	assert.Nil(t, err)
 
-	value, err := kvStorage.HGet("value", "name")
+	value, err := kvStorage.HGet(ctx, "value", "name")
 	if err.Error() != "key value not found" {
 		t.Error("Expected error for ramkv.Get")
 	}
 
-	if value != "" {
+	if len(value) != 0 {
 		t.Error("Unexpected hget value for uninitialized value")
 	}
 
-	err = kvStorage.HSet("value", "name", "simulator")
+	err = kvStorage.HSet(ctx, "value", "name", "simulator")
 	assert.Nil(t, err)
 
-	value, err = kvStorage.HGet("value", "name")
+	value, err = kvStorage.HGet(ctx, "value", "name")
 	assert.Nil(t, err)
 
-	if value != "simulator" {
+	if string(value) != "simulator" {
 		t.Error("Unexpected hget value for field name")
 	}
 
-	err = kvStorage.HSet("value", "name", 100)
+	err = kvStorage.HSet(ctx, "value", "name", 100)
 	if err != nil {
 		t.Error("Couln't hset value with field name and value simulator")
 	}
 
-	value, err = kvStorage.HGet("value", "name")
+	value, err = kvStorage.HGet(ctx, "value", "name")
 	assert.Nil(t, err)
 
-	if value != "100" {
+	if string(value) != "100" {
 		t.Error("Unexpected hget value for field name")
 	}
 
-	value, err = kvStorage.HGet("value", "value")
+	value, err = kvStorage.HGet(ctx, "value", "value")
 	if err.Error() != "field value not found" {
 		t.Error("Expected error for ramkv.Get")
 	}
 
-	if value != "" {
+	if len(value) != 0 {
 		t.Error("Unexpected hget value for field value")
 	}
 }
@@ -109,15 +116,15 @@ func TestHDelNotExisting(t *testing.T) {
 	kvStorage, err := New()
 	assert.Nil(t, err)
 
-	err = kvStorage.HSet("value", "name", "boem")
+	err = kvStorage.HSet(ctx, "value", "name", "boem")
 	if err != nil {
 		t.Error("no error expected for HSet")
 	}
 
-	err = kvStorage.HDel("value", "rik")
+	err = kvStorage.HDel(ctx, "value", "rik")
 	assert.Nil(t, err)
 
-	err = kvStorage.HDel("friet", "boembats")
+	err = kvStorage.HDel(ctx, "friet", "boembats")
 	assert.Nil(t, err)
 }
 
@@ -125,25 +132,25 @@ func TestHDel(t *testing.T) {
 	kvStorage, err := New()
 	assert.Nil(t, err)
 
-	err = kvStorage.HSet("value", "name", "simulator")
+	err = kvStorage.HSet(ctx, "value", "name", "simulator")
 	assert.Nil(t, err)
 
-	value, err := kvStorage.HGet("value", "name")
+	value, err := kvStorage.HGet(ctx, "value", "name")
 	assert.Nil(t, err)
 
-	if value != "simulator" {
+	if string(value) != "simulator" {
 		t.Error("Unexpected hget value for field name")
 	}
 
-	err = kvStorage.HDel("value", "name")
+	err = kvStorage.HDel(ctx, "value", "name")
 	assert.Nil(t, err)
 
-	value, err = kvStorage.HGet("value", "name")
+	value, err = kvStorage.HGet(ctx, "value", "name")
 	if err == nil {
 		t.Errorf("hget should fail")
 	}
 
-	if value != "" {
+	if len(value) != 0 {
 		t.Error("Unexpected hget value for removed value")
 	}
 }
@@ -152,17 +159,17 @@ func TestKeys(t *testing.T) {
 	kvStorage, err := New()
 	assert.Nil(t, err)
 
-	k, err := kvStorage.Keys("*")
+	k, err := kvStorage.Keys(ctx, "*")
 	assert.Nil(t, err)
 
 	if k != nil {
 		t.Error("keys must be nil")
 	}
 
-	kvStorage.Set("whots", "bats")
-	kvStorage.HSet("knal", "boem", "beng")
+	kvStorage.Set(ctx, "whots", "bats")
+	kvStorage.HSet(ctx, "knal", "boem", "beng")
 
-	k, err = kvStorage.Keys("*")
+	k, err = kvStorage.Keys(ctx, "*")
 	assert.Nil(t, err)
 
 	if k == nil {
@@ -171,4 +178,260 @@ func TestKeys(t *testing.T) {
 	if len(k) != 2 {
 		t.Errorf("expected 2 keys")
 	}
-}
\ No newline at end of file
+
+	k, err = kvStorage.Keys(ctx, "wh*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"whots"}, k)
+
+	k, err = kvStorage.Keys(ctx, "[kw]*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"knal", "whots"}, k)
+}
+
+func TestTypes(t *testing.T) {
+	kvStorage, err := New()
+	assert.Nil(t, err)
+
+	_, err = kvStorage.Type(ctx, "missing")
+	assert.IsType(t, &kv.NotFoundError{}, err)
+
+	kvStorage.Set(ctx, "string", 42)
+	kvStorage.HSet(ctx, "map", "field", "value")
+	kvStorage.RPush(ctx, "list", "a", "b", 3)
+
+	tp, err := kvStorage.Type(ctx, "string")
+	assert.Nil(t, err)
+	assert.Equal(t, types.KVTypeString, tp)
+
+	tp, err = kvStorage.Type(ctx, "map")
+	assert.Nil(t, err)
+	assert.Equal(t, types.KVTypeMap, tp)
+
+	tp, err = kvStorage.Type(ctx, "list")
+	assert.Nil(t, err)
+	assert.Equal(t, types.KVTypeList, tp)
+
+	value, err := kvStorage.Get(ctx, "string")
+	assert.Nil(t, err)
+	assert.Equal(t, "42", string(value))
+
+	list, err := kvStorage.LGet(ctx, "list")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "3"}, list)
+
+	_, err = kvStorage.Get(ctx, "list")
+	assert.NotNil(t, err)
+	_, err = kvStorage.LGet(ctx, "map")
+	assert.NotNil(t, err)
+	assert.NotNil(t, kvStorage.HSet(ctx, "string", "field", "value"))
+	assert.NotNil(t, kvStorage.RPush(ctx, "map", "x"))
+
+	// removing the last field removes the key
+	assert.Nil(t, kvStorage.HDel(ctx, "map", "field"))
+	_, err = kvStorage.Type(ctx, "map")
+	assert.NotNil(t, err)
+}
+
+func TestDatabases(t *testing.T) {
+	kvStorage, err := NewWithDatabases(2)
+	assert.Nil(t, err)
+
+	n, err := kvStorage.Databases(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	kvStorage.Set(ctx, "value", "db0")
+	assert.Nil(t, kvStorage.Database(ctx, 1))
+	_, err = kvStorage.Get(ctx, "value")
+	assert.NotNil(t, err)
+	kvStorage.Set(ctx, "value", "db1")
+
+	assert.Nil(t, kvStorage.Database(ctx, 0))
+	value, err := kvStorage.Get(ctx, "value")
+	assert.Nil(t, err)
+	assert.Equal(t, "db0", string(value))
+
+	assert.NotNil(t, kvStorage.Database(ctx, 2))
+	name, err := kvStorage.DatabaseName(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", name)
+
+	_, err = NewWithDatabases(0)
+	assert.NotNil(t, err)
+}
+
+func TestSets(t *testing.T) {
+	kvStorage, _ := New()
+
+	assert.Nil(t, kvStorage.SAdd(ctx, "set", "b", "a", "b"))
+	members, err := kvStorage.SMembers(ctx, "set")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, members)
+	tp, err := kvStorage.Type(ctx, "set")
+	assert.Nil(t, err)
+	assert.Equal(t, types.KVTypeSet, tp)
+
+	assert.Nil(t, kvStorage.ZAdd(ctx, "zset", kv.Z{Score: 2, Member: "two"}, kv.Z{Score: 1, Member: "one"}))
+	assert.Nil(t, kvStorage.ZAdd(ctx, "zset", kv.Z{Score: 3, Member: "one"}, kv.Z{Score: 2.5, Member: "half"}))
+	z, err := kvStorage.ZRangeWithScores(ctx, "zset", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []kv.Z{{Score: 2, Member: "two"}, {Score: 2.5, Member: "half"}, {Score: 3, Member: "one"}}, z)
+	z, err = kvStorage.ZRangeWithScores(ctx, "zset", -2, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []kv.Z{{Score: 2.5, Member: "half"}, {Score: 3, Member: "one"}}, z)
+	z, err = kvStorage.ZRangeWithScores(ctx, "zset", 2, 1)
+	assert.Nil(t, err)
+	assert.Empty(t, z)
+	tp, err = kvStorage.Type(ctx, "zset")
+	assert.Nil(t, err)
+	assert.Equal(t, types.KVTypeSortedSet, tp)
+
+	assert.NotNil(t, kvStorage.RPush(ctx, "set", "x"))
+	assert.NotNil(t, kvStorage.SAdd(ctx, "zset", "x"))
+	assert.NotNil(t, kvStorage.ZAdd(ctx, "set", kv.Z{Member: "x"}))
+	_, err = kvStorage.LGet(ctx, "set")
+	assert.NotNil(t, err)
+}
+
+func TestPaging(t *testing.T) {
+	kvStorage, _ := New()
+
+	assert.Nil(t, kvStorage.RPush(ctx, "list", "a", "b", "c", "d", "e"))
+	list, err := kvStorage.LRange(ctx, "list", 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "c"}, list)
+	list, err = kvStorage.LRange(ctx, "list", 3, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"d", "e"}, list)
+	list, err = kvStorage.LRange(ctx, "list", 5, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, list)
+	n, err := kvStorage.Len(ctx, "list")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+
+	for _, f := range []string{"c", "a", "b", "x"} {
+		assert.Nil(t, kvStorage.HSet(ctx, "hash", f, "v"))
+	}
+	cursor, fields, err := kvStorage.HScan(ctx, "hash", 0, "[abc]", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, fields)
+	cursor, fields, err = kvStorage.HScan(ctx, "hash", cursor, "[abc]", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), cursor)
+	assert.Equal(t, []string{"c"}, fields)
+
+	assert.Nil(t, kvStorage.SAdd(ctx, "set", "b", "a", "c"))
+	cursor, members, err := kvStorage.SScan(ctx, "set", 0, "*", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), cursor)
+	assert.Equal(t, []string{"a", "b"}, members)
+
+	assert.Nil(t, kvStorage.ZAdd(ctx, "zset", kv.Z{Score: 2, Member: "two"}, kv.Z{Score: 1, Member: "one"}))
+	cursor, z, err := kvStorage.ZScan(ctx, "zset", 0, "*", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), cursor)
+	assert.Equal(t, []kv.Z{{Score: 1, Member: "one"}, {Score: 2, Member: "two"}}, z)
+	n, err = kvStorage.Len(ctx, "zset")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	kvStorage.Set(ctx, "value", "x")
+	_, err = kvStorage.Len(ctx, "value")
+	assert.NotNil(t, err)
+}
+
+func TestExpire(t *testing.T) {
+	kvStorage, _ := New()
+
+	assert.NotNil(t, kvStorage.Expire(ctx, "value", time.Second))
+	kvStorage.Set(ctx, "value", "x")
+	assert.Nil(t, kvStorage.Expire(ctx, "value", time.Hour))
+	_, err := kvStorage.Get(ctx, "value")
+	assert.Nil(t, err)
+
+	assert.Nil(t, kvStorage.Expire(ctx, "value", 0))
+	_, err = kvStorage.Get(ctx, "value")
+	assert.NotNil(t, err)
+	keys, _ := kvStorage.Keys(ctx, "*")
+	assert.Empty(t, keys)
+
+	kvStorage.Set(ctx, "persist", "x")
+	kvStorage.Expire(ctx, "persist", time.Minute)
+	assert.Nil(t, kvStorage.Persist(ctx, "persist"))
+	ttl, err := kvStorage.TTL(ctx, "persist")
+	assert.Nil(t, err)
+	assert.True(t, ttl < 0)
+	assert.NotNil(t, kvStorage.Persist(ctx, "missing"))
+
+	// setting a value again removes the expiration
+	kvStorage.Set(ctx, "value", "y")
+	value, err := kvStorage.Get(ctx, "value")
+	assert.Nil(t, err)
+	assert.Equal(t, "y", string(value))
+}
+
+func TestDumpRestore(t *testing.T) {
+	kvStorage, _ := New()
+	assert.Implements(t, (*kv.Dumper)(nil), kvStorage)
+
+	kvStorage.HSet(ctx, "map", "field", "value")
+	kvStorage.SAdd(ctx, "set", "a", "b")
+	kvStorage.Expire(ctx, "set", time.Hour)
+
+	ttl, err := kvStorage.TTL(ctx, "map")
+	assert.Nil(t, err)
+	assert.True(t, ttl < 0)
+	ttl, err = kvStorage.TTL(ctx, "set")
+	assert.Nil(t, err)
+	assert.True(t, ttl > 59*time.Minute)
+
+	for _, key := range []string{"map", "set"} {
+		data, err := kvStorage.Dump(ctx, key)
+		assert.Nil(t, err)
+		assert.NotNil(t, kvStorage.Restore(ctx, key, 0, data))
+		kvStorage.Del(ctx, key)
+		assert.Nil(t, kvStorage.Restore(ctx, key, time.Minute, data))
+	}
+
+	value, err := kvStorage.HGet(ctx, "map", "field")
+	assert.Nil(t, err)
+	assert.Equal(t, "value", string(value))
+	members, err := kvStorage.SMembers(ctx, "set")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, members)
+	ttl, _ = kvStorage.TTL(ctx, "set")
+	assert.True(t, ttl > 0 && ttl <= time.Minute)
+
+	_, err = kvStorage.Dump(ctx, "missing")
+	assert.NotNil(t, err)
+}
+
+func TestEmptyAdd(t *testing.T) {
+	kvStorage, _ := New()
+
+	assert.NotNil(t, kvStorage.RPush(ctx, "list"))
+	assert.NotNil(t, kvStorage.SAdd(ctx, "set"))
+	assert.NotNil(t, kvStorage.ZAdd(ctx, "zset"))
+	keys, err := kvStorage.Keys(ctx, "*")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestRestoreEmpty(t *testing.T) {
+	kvStorage, _ := New()
+
+	// a hash and a sorted set emptied after being dumped
+	kvStorage.HSet(ctx, "map", "field", "value")
+	kvStorage.ZAdd(ctx, "zset", kv.Z{Member: "a", Score: 1})
+	kvStorage.storage[0]["map"].hash = map[string]string{}
+	kvStorage.storage[0]["zset"].zset = map[string]float64{}
+	for _, key := range []string{"map", "zset"} {
+		data, err := kvStorage.Dump(ctx, key)
+		assert.Nil(t, err)
+		kvStorage.Del(ctx, key)
+		assert.Nil(t, kvStorage.Restore(ctx, key, 0, data))
+	}
+	assert.Nil(t, kvStorage.HSet(ctx, "map", "field", "value"))
+	assert.Nil(t, kvStorage.ZAdd(ctx, "zset", kv.Z{Member: "a", Score: 1}))
+}
@@ -0,0 +1,452 @@
+package rediskv
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	// clusterSlots is the number of hash slots of a Redis Cluster
+	clusterSlots = 16384
+	// maxRedirects is the number of MOVED and ASK redirects followed for a
+	// command
+	maxRedirects = 5
+	// nodeCursorBits are the bits of a SCAN cursor of a cluster holding the
+	// cursor of the node, the bits above hold the index of the node
+	nodeCursorBits = 48
+)
+
+// cluster routes the commands of a Rediskv to the nodes of a Redis Cluster.
+// Commands on a key go to the primary serving its hash slot, SCAN goes to
+// every primary in turn or only to the selected one.
+type cluster struct {
+	opts Options
+
+	mu sync.Mutex
+	// slots holds the address of the primary serving each hash slot
+	slots []string
+	// primaries holds the sorted addresses of the primaries
+	primaries []string
+	// nodes holds the connections by address
+	nodes map[string]*Rediskv
+	// selected is the primary the keys are browsed of, 0 for all of them
+	// and i for primaries[i-1]
+	selected int
+}
+
+// dialCluster connects to the Redis Cluster with a node in opts
+func dialCluster(opts *Options) (*Rediskv, error) {
+	c := &cluster{opts: *opts, nodes: make(map[string]*Rediskv)}
+	c.opts.DB = 0
+	if err := c.refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	return &Rediskv{cluster: c}, nil
+}
+
+// keySlot returns the hash slot of key. Only the part between { and } is
+// hashed when it is there, so related keys can be put in the same slot.
+func keySlot(key string) int {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			key = key[i+1 : i+1+j]
+		}
+	}
+	return int(crc16(key)) % clusterSlots
+}
+
+// crc16 is CRC-16/XMODEM as used by Redis Cluster
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for b := 0; b < 8; b++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// node returns the connection to the node at addr, it connects when there
+// is none yet. Connecting is done without holding c.mu, so a slow node
+// does not hold up the commands to the others.
+func (c *cluster) node(addr string) (*Rediskv, error) {
+	c.mu.Lock()
+	n, ok := c.nodes[addr]
+	c.mu.Unlock()
+	if ok {
+		return n, nil
+	}
+	opts := c.opts
+	opts.Network, opts.Addr, opts.Cluster = "tcp", addr, nil
+	n, err := dialLink(&opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if other, ok := c.nodes[addr]; ok {
+		// connected to the node meanwhile
+		n.Close()
+		return other, nil
+	}
+	c.nodes[addr] = n
+	return n, nil
+}
+
+// refresh fetches the slots served by the primaries from the first node
+// that answers
+func (c *cluster) refresh(ctx context.Context) error {
+	c.mu.Lock()
+	addrs := append([]string(nil), c.primaries...)
+	c.mu.Unlock()
+	addrs = append(addrs, c.opts.Cluster...)
+
+	var errs []string
+	for _, addr := range addrs {
+		n, err := c.node(addr)
+		if err == nil {
+			var slots []string
+			if slots, err = fetchSlots(ctx, n, addr, c.opts.TLS != nil); err == nil {
+				c.setSlots(slots)
+				return nil
+			}
+		}
+		errs = append(errs, err.Error())
+	}
+	return fmt.Errorf("redis: no cluster node answered: %s", strings.Join(errs, ", "))
+}
+
+// setSlots makes slots the addresses of the primaries serving each slot
+func (c *cluster) setSlots(slots []string) {
+	seen := make(map[string]bool)
+	var primaries []string
+	for _, addr := range slots {
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			primaries = append(primaries, addr)
+		}
+	}
+	sort.Strings(primaries)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.slots, c.primaries = slots, primaries
+	if c.selected > len(primaries) {
+		c.selected = 0
+	}
+}
+
+// fetchSlots returns the address of the primary serving each slot, as told
+// by CLUSTER SHARDS or by CLUSTER SLOTS on servers before Redis 7. Nodes
+// without a known IP address are at the host of addr, the node asked.
+func fetchSlots(ctx context.Context, n *Rediskv, addr string, useTLS bool) ([]string, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	slots := make([]string, clusterSlots)
+	assign := func(start, end int64, ip string, port int64) error {
+		if start < 0 || end >= clusterSlots || start > end {
+			return fmt.Errorf("redis: invalid slot range %d-%d", start, end)
+		}
+		if ip == "" || ip == "?" {
+			ip = host
+		}
+		for s := start; s <= end; s++ {
+			slots[s] = net.JoinHostPort(ip, strconv.FormatInt(port, 10))
+		}
+		return nil
+	}
+
+	shards, err := redis.Values(n.do(ctx, "CLUSTER", "SHARDS"))
+	if err == nil {
+		return slots, parseShards(shards, useTLS, assign)
+	}
+	if _, ok := err.(redis.Error); !ok {
+		return nil, err
+	}
+	ranges, err := redis.Values(n.do(ctx, "CLUSTER", "SLOTS"))
+	if err != nil {
+		return nil, err
+	}
+	// each range is start, end, primary, replicas... with the nodes as
+	// ip, port, id...
+	for _, r := range ranges {
+		f, err := redis.Values(r, nil)
+		if err != nil || len(f) < 3 {
+			return nil, fmt.Errorf("redis: invalid cluster slots reply")
+		}
+		p, err := redis.Values(f[2], nil)
+		if err != nil || len(p) < 2 {
+			return nil, fmt.Errorf("redis: invalid cluster slots reply")
+		}
+		start, _ := redis.Int64(f[0], nil)
+		end, _ := redis.Int64(f[1], nil)
+		ip, _ := redis.String(p[0], nil)
+		port, _ := redis.Int64(p[1], nil)
+		if err := assign(start, end, ip, port); err != nil {
+			return nil, err
+		}
+	}
+	return slots, nil
+}
+
+// parseShards calls assign with the slot ranges of the primary of each
+// shard in a CLUSTER SHARDS reply
+func parseShards(shards []interface{}, useTLS bool, assign func(start, end int64, ip string, port int64) error) error {
+	for _, s := range shards {
+		shard, err := fields(s)
+		if err != nil {
+			return err
+		}
+		ranges, _ := redis.Int64s(shard["slots"], nil)
+		nodes, _ := redis.Values(shard["nodes"], nil)
+		for _, n := range nodes {
+			node, err := fields(n)
+			if err != nil {
+				return err
+			}
+			if role, _ := redis.String(node["role"], nil); role != "master" {
+				continue
+			}
+			ip, _ := redis.String(node["endpoint"], nil)
+			if ip == "" || ip == "?" {
+				ip, _ = redis.String(node["ip"], nil)
+			}
+			port, _ := redis.Int64(node["port"], nil)
+			if useTLS && node["tls-port"] != nil {
+				port, _ = redis.Int64(node["tls-port"], nil)
+			}
+			for i := 0; i+1 < len(ranges); i += 2 {
+				if err := assign(ranges[i], ranges[i+1], ip, port); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// fields returns the fields of a reply holding name, value, name, value...
+func fields(reply interface{}) (map[string]interface{}, error) {
+	values, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{}, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		name, err := redis.String(values[i], nil)
+		if err != nil {
+			return nil, err
+		}
+		m[name] = values[i+1]
+	}
+	return m, nil
+}
+
+// commandKey returns the key a command acts on
+func commandKey(cmd string, args []interface{}) (string, bool) {
+	i := 0
+	if cmd == "XINFO" {
+		// XINFO GROUPS key, XINFO CONSUMERS key group
+		i = 1
+	}
+	if len(args) <= i {
+		return "", false
+	}
+	key, ok := args[i].(string)
+	return key, ok
+}
+
+// do runs a command on the primary serving the slot of its key, following
+// the redirects of the cluster when the slot moved
+func (c *cluster) do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	c.mu.Lock()
+	addr := ""
+	if key, ok := commandKey(cmd, args); ok {
+		addr = c.slots[keySlot(key)]
+	} else if len(c.primaries) > 0 {
+		addr = c.primaries[0]
+	}
+	c.mu.Unlock()
+	if addr == "" {
+		return nil, fmt.Errorf("redis: no cluster node serves the slot of %s", cmd)
+	}
+
+	asking := false
+	for i := 0; i <= maxRedirects; i++ {
+		n, err := c.node(addr)
+		if err != nil {
+			return nil, err
+		}
+		var ret interface{}
+		if asking {
+			ret, err = n.doAsking(ctx, cmd, args...)
+		} else {
+			ret, err = n.do(ctx, cmd, args...)
+		}
+		// MOVED <slot> <addr> when the slot is served by another node,
+		// ASK <slot> <addr> when the slot is being migrated to it
+		e, ok := err.(redis.Error)
+		if !ok {
+			return ret, err
+		}
+		f := strings.Fields(string(e))
+		if len(f) != 3 || (f[0] != "MOVED" && f[0] != "ASK") {
+			return ret, err
+		}
+		slot, serr := strconv.Atoi(f[1])
+		if serr != nil || slot < 0 || slot >= clusterSlots {
+			return ret, err
+		}
+		addr, asking = f[2], f[0] == "ASK"
+		if !asking {
+			c.mu.Lock()
+			c.slots[slot] = addr
+			c.mu.Unlock()
+		}
+	}
+	return nil, fmt.Errorf("redis: too many cluster redirects for %s", cmd)
+}
+
+// doAsking runs cmd after ASKING, no other command is sent on the
+// connection between them
+func (r Rediskv) doAsking(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var ret interface{}
+	err := r.with(ctx, func(c redisCon) (err error) {
+		if _, err = c.Do("ASKING"); err != nil {
+			return err
+		}
+		ret, err = c.Do(cmd, args...)
+		return err
+	})
+	return ret, err
+}
+
+// scanNodes returns the addresses of the primaries scanned for keys
+func (c *cluster) scanNodes() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.selected > 0 {
+		return c.primaries[c.selected-1 : c.selected]
+	}
+	return c.primaries
+}
+
+// scan returns the next cursor and a page of keys of the scanned primaries,
+// they are scanned one after another. The cursor holds the index of the
+// primary above nodeCursorBits and the cursor of the primary below.
+func (c *cluster) scan(ctx context.Context, cursor uint64, pattern string, count int) (uint64, []string, error) {
+	nodes := c.scanNodes()
+	i := int(cursor >> nodeCursorBits)
+	if i >= len(nodes) {
+		return 0, nil, nil
+	}
+	n, err := c.node(nodes[i])
+	if err != nil {
+		return 0, nil, err
+	}
+	next, keys, err := n.Scan(ctx, cursor&(1<<nodeCursorBits-1), pattern, count)
+	if err != nil {
+		return 0, nil, err
+	}
+	if next >= 1<<nodeCursorBits {
+		return 0, nil, fmt.Errorf("redis: cursor of node %s too large", nodes[i])
+	}
+	if next == 0 {
+		if i++; i == len(nodes) {
+			return 0, keys, nil
+		}
+	}
+	return uint64(i)<<nodeCursorBits | next, keys, nil
+}
+
+// databases refreshes the slots and returns the number of databases: one
+// for all primaries and one per primary
+func (c *cluster) databases(ctx context.Context) (int, error) {
+	if err := c.refresh(ctx); err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.primaries) + 1, nil
+}
+
+// databaseName returns all for database 0 and the address of the primary
+// for the others
+func (c *cluster) databaseName(db int) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if db == 0 {
+		return "all", nil
+	}
+	if db < 0 || db > len(c.primaries) {
+		return "", fmt.Errorf("redis: no cluster node %d", db)
+	}
+	return c.primaries[db-1], nil
+}
+
+// selectNode selects the primary to browse the keys of, 0 for all of them
+func (c *cluster) selectNode(db int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if db < 0 || db > len(c.primaries) {
+		return fmt.Errorf("redis: no cluster node %d", db)
+	}
+	c.selected = db
+	return nil
+}
+
+// connected reports whether a connection to a node is up
+func (c *cluster) connected(ctx context.Context) (bool, error) {
+	c.mu.Lock()
+	nodes := make([]*Rediskv, 0, len(c.nodes))
+	for _, n := range c.nodes {
+		nodes = append(nodes, n)
+	}
+	c.mu.Unlock()
+	var err error
+	for _, n := range nodes {
+		if _, err = n.Connected(ctx); err == nil {
+			return true, nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("redis: not connected to a cluster node")
+	}
+	return false, err
+}
+
+// describe describes the browsed nodes
+func (c *cluster) describe() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.selected > 0 {
+		return "cluster node " + c.primaries[c.selected-1]
+	}
+	return fmt.Sprintf("cluster of %d primaries", len(c.primaries))
+}
+
+// close closes the connections to the nodes
+func (c *cluster) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, n := range c.nodes {
+		n.Close()
+		delete(c.nodes, addr)
+	}
+	return nil
+}
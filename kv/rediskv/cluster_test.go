@@ -0,0 +1,253 @@
+package rediskv
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeySlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		slot int
+	}{
+		{"", 0},
+		{"foo", 12182},
+		{"bar", 5061},
+		{"{bar}.baz", 5061},
+		{"user:{bar}", 5061},
+		{"foo{{bar}}", keySlot("{bar")},
+	}
+	for _, tt := range tests {
+		if slot := keySlot(tt.key); slot != tt.slot {
+			t.Errorf("keySlot(%q) = %d, want %d", tt.key, slot, tt.slot)
+		}
+	}
+	if keySlot("foo{}{bar}") == keySlot("bar") {
+		t.Error("an empty hash tag must hash the whole key")
+	}
+}
+
+// fakeCluster is a Redis Cluster of two primaries, a serves the slots below
+// split and b the others
+type fakeCluster struct {
+	a, b *fakeServer
+
+	mu    sync.Mutex
+	split int
+	// shards makes the nodes answer CLUSTER SHARDS, like Redis 7 does
+	shards bool
+	// asking holds the key a asks to be sent to b
+	asking string
+	// askingSent is set when b got ASKING
+	askingSent bool
+	keys       map[*fakeServer][]string
+}
+
+func newFakeCluster(t *testing.T, shards bool) *fakeCluster {
+	c := &fakeCluster{split: 8192, shards: shards}
+	c.a = newFakeServer(t, func(cmd []string) string { return c.reply(c.a, cmd) })
+	c.b = newFakeServer(t, func(cmd []string) string { return c.reply(c.b, cmd) })
+	c.keys = map[*fakeServer][]string{c.a: {"a1", "a2", "a3"}, c.b: {"b1"}}
+	return c
+}
+
+func (c *fakeCluster) close() {
+	c.a.l.Close()
+	c.b.l.Close()
+}
+
+// addrOf returns the host and port of s
+func addrOf(s *fakeServer) (string, string) {
+	host, port, _ := net.SplitHostPort(s.l.Addr().String())
+	return host, port
+}
+
+func (c *fakeCluster) reply(s *fakeServer, cmd []string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	aHost, aPort := addrOf(c.a)
+	bHost, bPort := addrOf(c.b)
+	switch cmd[0] {
+	case "CLUSTER":
+		if cmd[1] == "SHARDS" && c.shards {
+			shard := func(start, end int, host, port string) string {
+				node := "*10\r\n" + array("id", "x", "ip", host, "endpoint", "", "port")[4:] +
+					":" + port + "\r\n" + array("role", "master")[4:]
+				return "*4\r\n" + array("slots")[4:] + fmt.Sprintf("*2\r\n:%d\r\n:%d\r\n", start, end) +
+					array("nodes")[4:] + "*1\r\n" + node
+			}
+			return "*2\r\n" + shard(0, c.split-1, aHost, aPort) + shard(c.split, 16383, bHost, bPort)
+		}
+		if cmd[1] == "SLOTS" {
+			node := func(host, port string) string {
+				return "*3\r\n" + array(host)[4:] + ":" + port + "\r\n" + array("id")[4:]
+			}
+			return fmt.Sprintf("*2\r\n*3\r\n:0\r\n:%d\r\n%s*3\r\n:%d\r\n:16383\r\n%s", c.split-1, node("", aPort), c.split, node(bHost, bPort))
+		}
+		return "-ERR unknown subcommand\r\n"
+	case "ASKING":
+		c.askingSent = s == c.b
+		return "+OK\r\n"
+	case "SCAN":
+		keys := c.keys[s]
+		if cmd[1] == "0" {
+			return "*2\r\n" + array("7")[4:] + array(keys[:len(keys)-1]...)
+		}
+		return "*2\r\n" + array("0")[4:] + array(keys[len(keys)-1:]...)
+	}
+	key := cmd[1]
+	owner := c.a
+	if keySlot(key) >= c.split {
+		owner = c.b
+	}
+	if key == c.asking {
+		if s == c.a {
+			return fmt.Sprintf("-ASK %d %s\r\n", keySlot(key), c.b.l.Addr())
+		}
+		if c.askingSent {
+			owner = c.b
+		}
+	}
+	c.askingSent = false
+	if s != owner {
+		return fmt.Sprintf("-MOVED %d %s\r\n", keySlot(key), owner.l.Addr())
+	}
+	if s == c.a {
+		return array("a")[4:]
+	}
+	return array("b")[4:]
+}
+
+func testCluster(t *testing.T, shards bool) {
+	c := newFakeCluster(t, shards)
+	defer c.close()
+
+	kvStorage, err := New("redis+cluster://" + c.b.l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kvStorage.Close()
+	if !kvStorage.Cluster() {
+		t.Error("expected a cluster")
+	}
+
+	n, err := kvStorage.Databases(ctx)
+	if err != nil || n != 3 {
+		t.Fatalf("unexpected databases: %d %v", n, err)
+	}
+	nodes := []string{c.a.l.Addr().String(), c.b.l.Addr().String()}
+	sort.Strings(nodes)
+	for i, want := range append([]string{"all"}, nodes...) {
+		if name, _ := kvStorage.DatabaseName(ctx, i); name != want {
+			t.Errorf("DatabaseName(%d) = %s, want %s", i, name, want)
+		}
+	}
+
+	// bar hashes to slot 5061, foo to 12182
+	get := func(key, want string) {
+		value, err := kvStorage.Get(ctx, key)
+		if err != nil || string(value) != want {
+			t.Errorf("Get(%s) = %q, %v, want %s", key, value, err, want)
+		}
+	}
+	get("bar", "a")
+	get("foo", "b")
+
+	// all slots moved to b
+	c.mu.Lock()
+	c.split = 0
+	c.mu.Unlock()
+	get("bar", "b")
+	before := len(c.a.commands())
+	get("bar", "b")
+	if len(c.a.commands()) != before {
+		t.Error("the moved slot must go to b directly")
+	}
+
+	// slot of foo is being migrated from a to b
+	c.mu.Lock()
+	c.split, c.asking = 16384, "foo"
+	c.mu.Unlock()
+	get("foo", "b")
+
+	keys, err := kvStorage.Keys(ctx, "*")
+	sort.Strings(keys)
+	if err != nil || strings.Join(keys, ",") != "a1,a2,a3,b1" {
+		t.Errorf("unexpected keys of all nodes: %v %v", keys, err)
+	}
+	for i, node := range nodes {
+		if err := kvStorage.Database(ctx, i+1); err != nil {
+			t.Fatal(err)
+		}
+		keys, err := kvStorage.Keys(ctx, "*")
+		want := "a1,a2,a3"
+		if node == c.b.l.Addr().String() {
+			want = "b1"
+		}
+		if err != nil || strings.Join(keys, ",") != want {
+			t.Errorf("unexpected keys of node %s: %v %v", node, keys, err)
+		}
+		if kvStorage.Node() != "cluster node "+node {
+			t.Errorf("unexpected node: %s", kvStorage.Node())
+		}
+	}
+	if err := kvStorage.Database(ctx, 3); err == nil {
+		t.Error("selecting an unknown node must fail")
+	}
+}
+
+func TestCluster(t *testing.T) {
+	testCluster(t, true)
+}
+
+func TestClusterSlots(t *testing.T) {
+	testCluster(t, false)
+}
+
+func TestClusterSlowNode(t *testing.T) {
+	// a node that accepts connections but never replies
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	n, err := New(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	addr := l.Addr().String()
+	c := &cluster{nodes: map[string]*Rediskv{addr: n}, primaries: []string{addr}}
+
+	pctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	go c.connected(pctx)
+	time.Sleep(50 * time.Millisecond)
+
+	// the ping of the node must not hold up the others
+	done := make(chan struct{})
+	go func() {
+		c.describe()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Error("the cluster is locked while a node is pinged")
+	}
+}
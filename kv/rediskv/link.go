@@ -0,0 +1,147 @@
+package rediskv
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rikvdh/kvui/kv"
+)
+
+const (
+	// minBackoff and maxBackoff bound the time between reconnect attempts,
+	// it doubles with every failed attempt
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+var errClosed = errors.New("redis: connection closed")
+
+// link holds the connection of a Rediskv. When the connection breaks it
+// connects again on the next command, or once the backoff passed when
+// connecting failed, and selects the database that was selected.
+type link struct {
+	// dial connects to the node, without selecting a database
+	dial func() (*Rediskv, error)
+	// connected, when set, is called with l.mu held once the connection
+	// of a Rediskv returned by dial is in use
+	connected func(r *Rediskv)
+
+	mu    sync.Mutex
+	redis redisCon
+	conn  net.Conn
+	db    int
+	// failures counts the failed attempts to connect, retry is when the
+	// next attempt is made and err is why the last one failed
+	failures int
+	retry    time.Time
+	err      error
+	closed   bool
+}
+
+// newLink connects with dial and selects db, it fails when that fails.
+// connected may be nil.
+func newLink(dial func() (*Rediskv, error), db int, connected func(r *Rediskv)) (*link, error) {
+	l := &link{dial: dial, db: db, connected: connected}
+	r, err := l.connect()
+	if err != nil {
+		return nil, err
+	}
+	l.use(r)
+	return l, nil
+}
+
+// connect dials and selects the database, l.mu must be held unless l is
+// not shared yet
+func (l *link) connect() (*Rediskv, error) {
+	r, err := l.dial()
+	if err != nil {
+		return nil, err
+	}
+	if l.db != 0 {
+		if _, err := r.redis.Do("SELECT", l.db); err != nil {
+			r.conn.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// check reconnects when the connection broke, it returns a
+// kv.ReconnectError while the backoff after a failed attempt lasts. l.mu
+// must be held.
+func (l *link) check() error {
+	if l.closed {
+		return errClosed
+	}
+	if l.redis != nil && l.redis.Err() == nil {
+		return nil
+	}
+	if l.redis != nil && l.err == nil {
+		l.err = l.redis.Err()
+	}
+	if time.Now().Before(l.retry) {
+		return &kv.ReconnectError{Err: l.err, At: l.retry}
+	}
+	r, err := l.connect()
+	if err != nil {
+		l.failures++
+		backoff := maxBackoff
+		if l.failures < 6 {
+			backoff = minBackoff << uint(l.failures-1)
+		}
+		l.retry, l.err = time.Now().Add(backoff), err
+		return &kv.ReconnectError{Err: err, At: l.retry}
+	}
+	l.use(r)
+	return nil
+}
+
+// use replaces the connection by the one of r, l.mu must be held unless l
+// is not shared yet
+func (l *link) use(r *Rediskv) {
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	l.redis, l.conn = r.redis, r.conn
+	l.failures, l.retry, l.err = 0, time.Time{}, nil
+	if l.connected != nil {
+		l.connected(r)
+	}
+}
+
+// swap replaces the connection by the one of r, selecting the database
+func (l *link) swap(r *Rediskv) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return r.conn.Close()
+	}
+	if l.db != 0 {
+		if _, err := r.redis.Do("SELECT", l.db); err != nil {
+			r.conn.Close()
+			return err
+		}
+	}
+	l.use(r)
+	return nil
+}
+
+// selected records db as the selected database
+func (l *link) selected(db int) {
+	l.mu.Lock()
+	l.db = db
+	l.mu.Unlock()
+}
+
+// close closes the connection
+func (l *link) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.Close()
+}
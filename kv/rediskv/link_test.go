@@ -0,0 +1,75 @@
+package rediskv
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rikvdh/kvui/kv"
+)
+
+// drop closes the connections of the clients of s
+func (s *fakeServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+func TestReconnect(t *testing.T) {
+	s := fakeNode(t, "a")
+	addr := s.l.Addr().String()
+
+	kvStorage, err := New(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kvStorage.Close()
+	if err := kvStorage.Database(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first command after the connection broke fails, the next one
+	// connects again and selects the database
+	s.drop()
+	kvStorage.Get(ctx, "value")
+	before := len(s.commands())
+	if value, err := kvStorage.Get(ctx, "value"); err != nil || string(value) != "a" {
+		t.Errorf("unexpected value after reconnect: %q %v", value, err)
+	}
+	if cmds := s.commands()[before:]; len(cmds) != 2 || cmds[0] != "SELECT 3" {
+		t.Errorf("database not selected after reconnect: %q", cmds)
+	}
+
+	// the server is down
+	s.l.Close()
+	s.drop()
+	kvStorage.Get(ctx, "value")
+	_, err = kvStorage.Get(ctx, "value")
+	re, ok := err.(*kv.ReconnectError)
+	if !ok {
+		t.Fatalf("expected a reconnect error: %v", err)
+	}
+	if in := re.In(); in != minBackoff {
+		t.Errorf("unexpected backoff: %s", in)
+	}
+	if _, err := kvStorage.Connected(ctx); err == nil || err.(*kv.ReconnectError).At != re.At {
+		t.Errorf("no attempt must be made during the backoff: %v", err)
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	s = serveFake(l, s.reply)
+	defer l.Close()
+	time.Sleep(re.At.Sub(time.Now()))
+	if con, err := kvStorage.Connected(ctx); !con || err != nil {
+		t.Errorf("not reconnected: %v", err)
+	}
+	if cmds := s.commands(); len(cmds) == 0 || cmds[0] != "SELECT 3" {
+		t.Errorf("database not selected after reconnect: %q", cmds)
+	}
+}
@@ -1,102 +1,596 @@
 package rediskv
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/garyburd/redigo/redis"
+	"github.com/rikvdh/kvui/kv"
 	"github.com/rikvdh/kvui/kv/types"
 )
 
+func init() {
+	kv.Register(kv.TypeRedis, func(params string) (kv.KV, error) {
+		return New(params)
+	})
+}
+
 type redisCon interface {
 	Err() error
 	Do(cmd string, args ...interface{}) (interface{}, error)
 }
 
+// pipeliner is implemented by connections that can pipeline commands
+type pipeliner interface {
+	Send(cmd string, args ...interface{}) error
+	Flush() error
+	Receive() (interface{}, error)
+}
+
 // Rediskv stores the values that is set or retrieved in Redis
 type Rediskv struct {
 	redis redisCon
+	// conn is the network connection underneath redis, used to apply
+	// the deadline of a context to a command
+	conn net.Conn
+	// addr is the address the connection was made to
+	addr string
+	// link holds the connection instead of redis and conn, it connects
+	// again when the connection breaks
+	link *link
+	// sentinel names the node link connects to when it is found by Redis
+	// Sentinel
+	sentinel *sentinel
+	// cluster routes the commands to the nodes of a Redis Cluster, it is
+	// used instead of redis and conn
+	cluster *cluster
+}
+
+// do runs a command honoring the deadline and cancellation of ctx. The
+// deadline is applied as read/write deadline on the connection, so a
+// stalled server results in a timeout error instead of a blocked call.
+func (r Rediskv) do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if r.cluster != nil {
+		return r.cluster.do(ctx, cmd, args...)
+	}
+	var ret interface{}
+	err := r.with(ctx, func(c redisCon) (err error) {
+		ret, err = c.Do(cmd, args...)
+		return err
+	})
+	return ret, err
+}
+
+// with runs fn on the connection, the deadline of ctx applies to the
+// commands fn runs
+func (r Rediskv) with(ctx context.Context, fn func(c redisCon) error) error {
+	if r.link != nil {
+		r.link.mu.Lock()
+		defer r.link.mu.Unlock()
+		if err := r.link.check(); err != nil {
+			return err
+		}
+		r.redis, r.conn = r.link.redis, r.link.conn
+	}
+	if r.conn == nil {
+		return fn(r.redis)
+	}
+
+	deadline, _ := ctx.Deadline()
+	if err := r.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	if done := ctx.Done(); done != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-done:
+				// unblock the pending read or write
+				r.conn.SetDeadline(time.Now())
+			case <-stop:
+			}
+		}()
+	}
+	err := fn(r.redis)
+	if cerr := ctx.Err(); err != nil && cerr != nil {
+		return cerr
+	}
+	return err
 }
 
 // Get returns the value from the requested key.
-func (r Rediskv) Get(key string) (string, error) {
-	v, e := r.redis.Do("GET", key)
-	log.Println(v)
-	return redis.String(v, e)
+func (r Rediskv) Get(ctx context.Context, key string) ([]byte, error) {
+	return redis.Bytes(r.do(ctx, "GET", key))
 }
 
 // Set stores the value with the given key
-func (r Rediskv) Set(key string, value interface{}) error {
-	_, err := r.redis.Do("SET", key, value)
+func (r Rediskv) Set(ctx context.Context, key string, value interface{}) error {
+	_, err := r.do(ctx, "SET", key, value)
 	return err
 }
 
-// Keys returns a list of keys matched by pattern
-func (r Rediskv) Keys(pattern string) ([]string, error) {
-	// Note: maybe use scan instead of keys. Keys has a great performance impact
-	// See: https://redis.io/commands/keys, https://redis.io/commands/scan
-	return redis.Strings(r.redis.Do("KEYS", pattern))
+// Keys returns a list of keys matched by pattern. It iterates using SCAN
+// to not block the server, see https://redis.io/commands/keys
+func (r Rediskv) Keys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	it := kv.NewKeyIterator(r, pattern, 1000)
+	for it.Next(ctx) {
+		keys = append(keys, it.Keys()...)
+	}
+	return keys, it.Err()
+}
+
+// Scan returns the next cursor and a page of keys matched by pattern,
+// count is passed as COUNT hint, see https://redis.io/commands/scan
+func (r Rediskv) Scan(ctx context.Context, cursor uint64, pattern string, count int) (uint64, []string, error) {
+	if r.cluster != nil {
+		return r.cluster.scan(ctx, cursor, pattern, count)
+	}
+	next, page, err := r.scan(ctx, "SCAN", nil, cursor, pattern, count)
+	if err != nil {
+		return 0, nil, err
+	}
+	keys, err := redis.Strings(page, nil)
+	return next, keys, err
+}
+
+// scan runs one of the SCAN commands and returns the next cursor and the
+// page of the reply
+func (r Rediskv) scan(ctx context.Context, cmd string, key interface{}, cursor uint64, pattern string, count int) (uint64, interface{}, error) {
+	if count <= 0 {
+		count = kv.DefaultScanCount
+	}
+	args := []interface{}{cursor, "MATCH", pattern, "COUNT", count}
+	if key != nil {
+		args = append([]interface{}{key}, args...)
+	}
+	ret, err := redis.Values(r.do(ctx, cmd, args...))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(ret) != 2 {
+		return 0, nil, fmt.Errorf("invalid %s reply", strings.ToLower(cmd))
+	}
+	next, err := redis.Uint64(ret[0], nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	return next, ret[1], nil
 }
 
 // Del removes the value with the given key
-func (r Rediskv) Del(key string) error {
-	_, err := r.redis.Do("DEL", key)
+func (r Rediskv) Del(ctx context.Context, key string) error {
+	_, err := r.do(ctx, "DEL", key)
 	return err
 }
 
 // HKeys returns all keys in a hash
-func (r Rediskv) HKeys(key string) ([]string, error) {
-	return redis.Strings(r.redis.Do("HKEYS", key))
+func (r Rediskv) HKeys(ctx context.Context, key string) ([]string, error) {
+	return redis.Strings(r.do(ctx, "HKEYS", key))
+}
+
+// HScan returns the next cursor and a page of the fields of a hash
+// matched by pattern
+func (r Rediskv) HScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []string, error) {
+	next, page, err := r.scan(ctx, "HSCAN", key, cursor, pattern, count)
+	if err != nil {
+		return 0, nil, err
+	}
+	pairs, err := redis.Strings(page, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	// the reply holds field, value, field, value...
+	fields := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fields = append(fields, pairs[i])
+	}
+	return next, fields, nil
 }
 
 // HGet retrieve the value from the given field in the given key
-func (r Rediskv) HGet(key, field string) (string, error) {
-	return redis.String(r.redis.Do("HGET", key, field))
+func (r Rediskv) HGet(ctx context.Context, key, field string) ([]byte, error) {
+	return redis.Bytes(r.do(ctx, "HGET", key, field))
 }
 
 // HSet sets the value in the given field in the given key
-func (r Rediskv) HSet(key, field string, value interface{}) error {
-	_, err := r.redis.Do("HSET", key, field, value)
+func (r Rediskv) HSet(ctx context.Context, key, field string, value interface{}) error {
+	_, err := r.do(ctx, "HSET", key, field, value)
 	return err
 }
 
 // HDel removes the value in the given field in the given key
-func (r Rediskv) HDel(key, field string) error {
-	_, err := r.redis.Do("HDEL", key, field)
+func (r Rediskv) HDel(ctx context.Context, key, field string) error {
+	_, err := r.do(ctx, "HDEL", key, field)
 	return err
 }
 
-func (r Rediskv) LGet(key string) ([]string, error) {
-	t, err := redis.String(r.redis.Do("TYPE", key))
+// LGet returns all elements of a list
+func (r Rediskv) LGet(ctx context.Context, key string) ([]string, error) {
+	return redis.Strings(r.do(ctx, "LRANGE", key, "0", "-1"))
+}
+
+// LRange returns at most count elements of a list starting at index offset
+func (r Rediskv) LRange(ctx context.Context, key string, offset, count int) ([]string, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+	return redis.Strings(r.do(ctx, "LRANGE", key, offset, offset+count-1))
+}
+
+// SMembers returns all members of a set
+func (r Rediskv) SMembers(ctx context.Context, key string) ([]string, error) {
+	return redis.Strings(r.do(ctx, "SMEMBERS", key))
+}
+
+// SScan returns the next cursor and a page of the members of a set
+// matched by pattern
+func (r Rediskv) SScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []string, error) {
+	next, page, err := r.scan(ctx, "SSCAN", key, cursor, pattern, count)
+	if err != nil {
+		return 0, nil, err
+	}
+	members, err := redis.Strings(page, nil)
+	return next, members, err
+}
+
+// ZScan returns the next cursor and a page of the members of a sorted set
+// matched by pattern with their scores
+func (r Rediskv) ZScan(ctx context.Context, key string, cursor uint64, pattern string, count int) (uint64, []kv.Z, error) {
+	next, page, err := r.scan(ctx, "ZSCAN", key, cursor, pattern, count)
+	if err != nil {
+		return 0, nil, err
+	}
+	members, err := zMembers(page, nil)
+	return next, members, err
+}
+
+// Len returns the number of elements in the list, hash, set, sorted set or
+// stream stored at key
+func (r Rediskv) Len(ctx context.Context, key string) (int, error) {
+	t, err := r.Type(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	cmd, ok := lenCommands[t]
+	if !ok {
+		return 0, fmt.Errorf("%s is a %s, it has no elements", key, t)
+	}
+	return redis.Int(r.do(ctx, cmd, key))
+}
+
+// lenCommands are the commands returning the number of elements per type
+var lenCommands = map[types.KVType]string{
+	types.KVTypeList:      "LLEN",
+	types.KVTypeMap:       "HLEN",
+	types.KVTypeSet:       "SCARD",
+	types.KVTypeSortedSet: "ZCARD",
+	types.KVTypeStream:    "XLEN",
+}
+
+// ZRangeWithScores returns the members of a sorted set from index start up
+// to and including stop with their scores
+func (r Rediskv) ZRangeWithScores(ctx context.Context, key string, start, stop int) ([]kv.Z, error) {
+	return zMembers(r.do(ctx, "ZRANGE", key, start, stop, "WITHSCORES"))
+}
+
+// zMembers converts a member, score, member, score... reply
+func zMembers(reply interface{}, err error) ([]kv.Z, error) {
+	values, err := redis.Strings(reply, err)
 	if err != nil {
 		return nil, err
 	}
-	switch t {
-	case "list":
-		return redis.Strings(r.redis.Do("LRANGE", key, "0", "-1"))
-	case "set":
-		return redis.Strings(r.redis.Do("SMEMBERS", key))
-	case "zset":
-		return redis.Strings(r.redis.Do("ZRANGE", key, "0", "-1"))
+	if len(values)%2 != 0 {
+		return nil, fmt.Errorf("invalid sorted set reply")
+	}
+	members := make([]kv.Z, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		score, err := strconv.ParseFloat(values[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, kv.Z{Score: score, Member: values[i]})
+	}
+	return members, nil
+}
+
+// XRange returns at most count entries of a stream from start up to and
+// including end
+func (r Rediskv) XRange(ctx context.Context, key, start, end string, count int) ([]kv.XMessage, error) {
+	return xMessages(r.do(ctx, "XRANGE", key, start, end, "COUNT", count))
+}
+
+// XRevRange returns at most count entries of a stream from end down to
+// and including start
+func (r Rediskv) XRevRange(ctx context.Context, key, end, start string, count int) ([]kv.XMessage, error) {
+	return xMessages(r.do(ctx, "XREVRANGE", key, end, start, "COUNT", count))
+}
+
+// xMessages converts a reply of XRANGE or XREVRANGE
+func xMessages(reply interface{}, err error) ([]kv.XMessage, error) {
+	entries, err := redis.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]kv.XMessage, 0, len(entries))
+	for _, e := range entries {
+		entry, err := redis.Values(e, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(entry) != 2 {
+			return nil, fmt.Errorf("invalid stream entry")
+		}
+		id, err := redis.String(entry[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		values, err := redis.Strings(entry[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, kv.XMessage{ID: id, Values: values})
+	}
+	return msgs, nil
+}
+
+// infoMaps converts a reply of XINFO GROUPS or CONSUMERS, a list of
+// name, value, name, value... lists
+func infoMaps(reply interface{}, err error) ([]map[string]interface{}, error) {
+	list, err := redis.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]map[string]interface{}, 0, len(list))
+	for _, l := range list {
+		values, err := redis.Values(l, nil)
+		if err != nil {
+			return nil, err
+		}
+		info := make(map[string]interface{}, len(values)/2)
+		for i := 0; i+1 < len(values); i += 2 {
+			name, err := redis.String(values[i], nil)
+			if err != nil {
+				return nil, err
+			}
+			info[name] = values[i+1]
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// XInfoGroups returns the consumer groups of a stream
+func (r Rediskv) XInfoGroups(ctx context.Context, key string) ([]kv.XInfoGroup, error) {
+	infos, err := infoMaps(r.do(ctx, "XINFO", "GROUPS", key))
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]kv.XInfoGroup, 0, len(infos))
+	for _, info := range infos {
+		var g kv.XInfoGroup
+		g.Name, _ = redis.String(info["name"], nil)
+		g.Consumers, _ = redis.Int64(info["consumers"], nil)
+		g.Pending, _ = redis.Int64(info["pending"], nil)
+		g.LastDeliveredID, _ = redis.String(info["last-delivered-id"], nil)
+		groups = append(groups, g)
 	}
-	return nil, fmt.Errorf("invalid type: %s", t)
+	return groups, nil
+}
+
+// XInfoConsumers returns the consumers in a consumer group of a stream
+func (r Rediskv) XInfoConsumers(ctx context.Context, key, group string) ([]kv.XInfoConsumer, error) {
+	infos, err := infoMaps(r.do(ctx, "XINFO", "CONSUMERS", key, group))
+	if err != nil {
+		return nil, err
+	}
+	consumers := make([]kv.XInfoConsumer, 0, len(infos))
+	for _, info := range infos {
+		var c kv.XInfoConsumer
+		c.Name, _ = redis.String(info["name"], nil)
+		c.Pending, _ = redis.Int64(info["pending"], nil)
+		idle, _ := redis.Int64(info["idle"], nil)
+		c.Idle = time.Duration(idle) * time.Millisecond
+		consumers = append(consumers, c)
+	}
+	return consumers, nil
+}
+
+// RPush appends values to the list stored at key
+func (r Rediskv) RPush(ctx context.Context, key string, values ...interface{}) error {
+	_, err := r.do(ctx, "RPUSH", append([]interface{}{key}, values...)...)
+	return err
+}
+
+// SAdd adds members to the set stored at key
+func (r Rediskv) SAdd(ctx context.Context, key string, members ...interface{}) error {
+	_, err := r.do(ctx, "SADD", append([]interface{}{key}, members...)...)
+	return err
+}
+
+// ZAdd adds members to the sorted set stored at key, or updates their score
+func (r Rediskv) ZAdd(ctx context.Context, key string, members ...kv.Z) error {
+	args := []interface{}{key}
+	for _, z := range members {
+		args = append(args, z.Score, z.Member)
+	}
+	_, err := r.do(ctx, "ZADD", args...)
+	return err
+}
+
+// Expire sets a timeout on key, after which the key is removed
+func (r Rediskv) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	ok, err := redis.Bool(r.do(ctx, "PEXPIRE", key, int64(ttl/time.Millisecond)))
+	if err == nil && !ok {
+		err = fmt.Errorf("key %s not found", key)
+	}
+	return err
+}
+
+// TTL returns the time left before key expires, it is negative for keys
+// without expiration
+func (r Rediskv) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ms, err := redis.Int64(r.do(ctx, "PTTL", key))
+	if err != nil {
+		return 0, err
+	}
+	if ms == -2 {
+		return 0, fmt.Errorf("key %s not found", key)
+	}
+	return pttl(ms), nil
+}
+
+// TTLs returns the TTL of the keys that exist, the PTTL commands are
+// pipelined so they take a single round trip. A cluster asks the TTLs one
+// by one as the keys can be on several nodes.
+func (r Rediskv) TTLs(ctx context.Context, keys []string) (map[string]time.Duration, error) {
+	ttls := make(map[string]time.Duration, len(keys))
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if r.cluster != nil {
+		for _, k := range keys {
+			ttl, err := r.TTL(ctx, k)
+			if cerr := ctx.Err(); cerr != nil {
+				return nil, cerr
+			}
+			if err == nil {
+				ttls[k] = ttl
+			}
+		}
+		return ttls, nil
+	}
+	err := r.with(ctx, func(c redisCon) error {
+		p, ok := c.(pipeliner)
+		if !ok {
+			for _, k := range keys {
+				ms, err := redis.Int64(c.Do("PTTL", k))
+				if _, ok := err.(redis.Error); ok {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if ms != -2 {
+					ttls[k] = pttl(ms)
+				}
+			}
+			return nil
+		}
+		for _, k := range keys {
+			if err := p.Send("PTTL", k); err != nil {
+				return err
+			}
+		}
+		if err := p.Flush(); err != nil {
+			return err
+		}
+		// keys with an error reply are left out, the replies after it
+		// are still read to keep the connection in sync
+		for _, k := range keys {
+			ms, err := redis.Int64(p.Receive())
+			if _, ok := err.(redis.Error); ok {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if ms != -2 {
+				ttls[k] = pttl(ms)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ttls, nil
+}
+
+// pttl converts a reply of PTTL of an existing key to a TTL
+func pttl(ms int64) time.Duration {
+	if ms < 0 {
+		return -1
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Persist removes the expiration of key
+func (r Rediskv) Persist(ctx context.Context, key string) error {
+	_, err := r.do(ctx, "PERSIST", key)
+	return err
+}
+
+// Dump serializes the value stored at key, see https://redis.io/commands/dump
+func (r Rediskv) Dump(ctx context.Context, key string) ([]byte, error) {
+	data, err := redis.Bytes(r.do(ctx, "DUMP", key))
+	if err == redis.ErrNil {
+		return nil, fmt.Errorf("key %s not found", key)
+	}
+	return data, err
+}
+
+// Restore creates key from data serialized by Dump, a ttl of zero or less
+// creates it without expiration
+func (r Rediskv) Restore(ctx context.Context, key string, ttl time.Duration, data []byte) error {
+	if ttl < 0 {
+		ttl = 0
+	}
+	_, err := r.do(ctx, "RESTORE", key, int64(ttl/time.Millisecond), data)
+	return err
 }
 
 // Databases requested from config
-func (r Rediskv) Databases() (int, error) {
-	ret, err := redis.Values(r.redis.Do("CONFIG", "GET", "databases"))
+func (r Rediskv) Databases(ctx context.Context) (int, error) {
+	if r.cluster != nil {
+		return r.cluster.databases(ctx)
+	}
+	ret, err := redis.Values(r.do(ctx, "CONFIG", "GET", "databases"))
 	if len(ret) > 1 {
 		return redis.Int(ret[1], err)
 	}
 	return 0, err
 }
 
-func (r Rediskv) Database(db int) error {
-	_, err := r.redis.Do("SELECT", db)
+func (r Rediskv) Database(ctx context.Context, db int) error {
+	if r.cluster != nil {
+		return r.cluster.selectNode(db)
+	}
+	_, err := r.do(ctx, "SELECT", db)
+	if err == nil && r.link != nil {
+		r.link.selected(db)
+	}
 	return err
 }
 
-func (r Rediskv) Connected() (bool, error) {
+// DatabaseName returns the name of a numbered Redis database
+func (r Rediskv) DatabaseName(ctx context.Context, db int) (string, error) {
+	if r.cluster != nil {
+		return r.cluster.databaseName(db)
+	}
+	return strconv.Itoa(db), nil
+}
+
+// Connected reports whether the connection is up. With a link it pings the
+// server, which notices a broken connection and reconnects.
+func (r Rediskv) Connected(ctx context.Context) (bool, error) {
+	if r.cluster != nil {
+		return r.cluster.connected(ctx)
+	}
+	if r.link != nil {
+		if _, err := r.do(ctx, "PING"); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
 	err := r.redis.Err()
 	ret := true
 	if err != nil {
@@ -105,8 +599,12 @@ func (r Rediskv) Connected() (bool, error) {
 	return ret, err
 }
 
-func (r Rediskv) Type(key string) (types.KVType, error) {
-	t, err := redis.String(r.redis.Do("TYPE", key))
+// Type returns the type of the value stored at key
+func (r Rediskv) Type(ctx context.Context, key string) (types.KVType, error) {
+	t, err := redis.String(r.do(ctx, "TYPE", key))
+	if err == nil && t == "none" {
+		return types.KVTypeInvalid, &kv.NotFoundError{Key: key}
+	}
 	if err == nil {
 		return r.redisTypeToKVType(t)
 	}
@@ -119,20 +617,130 @@ func (r Rediskv) redisTypeToKVType(t string) (types.KVType, error) {
 		return types.KVTypeMap, nil
 	case "string":
 		return types.KVTypeString, nil
-	case "list", "set", "zset":
+	case "list":
 		return types.KVTypeList, nil
+	case "set":
+		return types.KVTypeSet, nil
+	case "zset":
+		return types.KVTypeSortedSet, nil
+	case "stream":
+		return types.KVTypeStream, nil
 	}
 	return types.KVTypeInvalid, fmt.Errorf("invalid type: %s", t)
 }
 
-// New creates a Redis key value instance
-func New(host string) (*Rediskv, error) {
-	rediskv := Rediskv{}
-	redisCon, err := redis.Dial("tcp", host)
+// New creates a Redis key value instance, params is a host:port address or
+// a redis://, rediss:// or unix:// URL as accepted by ParseURL
+func New(params string) (*Rediskv, error) {
+	opts, err := ParseURL(params)
+	if err != nil {
+		return nil, err
+	}
+	return Dial(opts)
+}
+
+// Dial connects to the Redis server with opts, it authenticates and selects
+// the database when these are set. With sentinels in opts it connects to
+// the node they name and follows it during failovers. When the connection
+// breaks it connects again and selects the database that was selected.
+func Dial(opts *Options) (*Rediskv, error) {
+	if len(opts.Sentinels) > 0 {
+		return dialSentinel(opts)
+	}
+	if len(opts.Cluster) > 0 {
+		return dialCluster(opts)
+	}
+	return dialLink(opts)
+}
+
+// dialLink connects to the Redis server at the address in opts through a
+// link
+func dialLink(opts *Options) (*Rediskv, error) {
+	o := *opts
+	o.DB = 0
+	l, err := newLink(func() (*Rediskv, error) { return dial(&o) }, opts.DB, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Rediskv{link: l}, nil
+}
+
+// dial connects to the Redis server at the address in opts
+func dial(opts *Options) (*Rediskv, error) {
+	rediskv := Rediskv{addr: opts.Addr}
+	dialOpts := []redis.DialOption{
+		redis.DialNetDial(func(network, addr string) (net.Conn, error) {
+			c, err := net.DialTimeout(network, addr, 10*time.Second)
+			rediskv.conn = c
+			return c, err
+		}),
+	}
+	if opts.TLS != nil {
+		dialOpts = append(dialOpts, redis.DialUseTLS(true), redis.DialTLSConfig(opts.TLS))
+	}
+	redisCon, err := redis.Dial(opts.Network, opts.Addr, dialOpts...)
 	if err != nil {
 		return nil, err
 	}
+	if err := setup(redisCon, opts); err != nil {
+		redisCon.Close()
+		return nil, err
+	}
 	rediskv.redis = redisCon
 
 	return &rediskv, nil
 }
+
+// setup authenticates and selects the database on a new connection
+func setup(c redis.Conn, opts *Options) error {
+	if opts.Password != "" {
+		args := []interface{}{opts.Password}
+		if opts.Username != "" {
+			args = []interface{}{opts.Username, opts.Password}
+		}
+		if _, err := c.Do("AUTH", args...); err != nil {
+			return err
+		}
+	}
+	if opts.DB != 0 {
+		if _, err := c.Do("SELECT", opts.DB); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection to Redis
+func (r Rediskv) Close() error {
+	if r.sentinel != nil {
+		r.sentinel.close()
+	}
+	if r.cluster != nil {
+		return r.cluster.close()
+	}
+	if r.link != nil {
+		return r.link.close()
+	}
+	if r.conn == nil {
+		return nil
+	}
+	return r.conn.Close()
+}
+
+// Node describes the Redis node in use when it is found by Redis Sentinel
+// or the browsed nodes of a Redis Cluster, otherwise it is empty
+func (r Rediskv) Node() string {
+	if r.cluster != nil {
+		return r.cluster.describe()
+	}
+	if r.sentinel == nil {
+		return ""
+	}
+	return r.sentinel.node()
+}
+
+// Cluster reports whether r is connected to a Redis Cluster, its databases
+// are the nodes then
+func (r Rediskv) Cluster() bool {
+	return r.cluster != nil
+}
@@ -1,10 +1,19 @@
 package rediskv
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"net"
 	"testing"
+	"time"
+
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/types"
 )
 
+var ctx = context.Background()
+
 type redisMock struct {
 	Result interface{}
 	err    error
@@ -26,7 +35,7 @@ func TestGetSet(t *testing.T) {
 	mock.Result = nil
 	mock.err = nil
 
-	err := kvStorage.Set("value", `"{"name": "simulator", "value": "20"}"`)
+	err := kvStorage.Set(ctx, "value", `"{"name": "simulator", "value": "20"}"`)
 	if err != nil {
 		t.Error("Couln't set value name:simulator, value:20")
 	}
@@ -34,15 +43,21 @@ func TestGetSet(t *testing.T) {
 	mock.Result = `"{"name": "simulator", "value": "20"}"`
 	mock.err = nil
 
-	value, err := kvStorage.Get("value")
+	value, err := kvStorage.Get(ctx, "value")
 	if err != nil {
 		t.Error("Couln't get value for initialized value")
 		t.Error(err)
 	}
 
-	if value != `"{"name": "simulator", "value": "20"}"` {
+	if string(value) != `"{"name": "simulator", "value": "20"}"` {
 		t.Error("Unexpected get value for initialized value")
 	}
+
+	mock.Result = []byte{0x1f, 0x8b, 0xff}
+	value, err = kvStorage.Get(ctx, "value")
+	if err != nil || !bytes.Equal(value, []byte{0x1f, 0x8b, 0xff}) {
+		t.Errorf("binary values must be returned as they are: %q %v", value, err)
+	}
 }
 
 func TestDel(t *testing.T) {
@@ -53,7 +68,7 @@ func TestDel(t *testing.T) {
 	mock.Result = nil
 	mock.err = nil
 
-	err := kvStorage.Set("value", `{"name": "simulator", "value": "20"}`)
+	err := kvStorage.Set(ctx, "value", `{"name": "simulator", "value": "20"}`)
 	if err != nil {
 		t.Error("Couln't set value name:simulator, value:20")
 	}
@@ -61,19 +76,19 @@ func TestDel(t *testing.T) {
 	mock.Result = `{"name": "simulator", "value": "20"}`
 	mock.err = nil
 
-	value, err := kvStorage.Get("value")
+	value, err := kvStorage.Get(ctx, "value")
 	if err != nil {
 		t.Error("Couln't get value for initialized value")
 	}
 
-	if value != `{"name": "simulator", "value": "20"}` {
+	if string(value) != `{"name": "simulator", "value": "20"}` {
 		t.Errorf("Unexpected get value for initialized value got: %v", value)
 	}
 
 	mock.Result = nil
 	mock.err = nil
 
-	err = kvStorage.Del("value")
+	err = kvStorage.Del(ctx, "value")
 	if err != nil {
 		t.Error("Couln't del value")
 	}
@@ -81,12 +96,12 @@ func TestDel(t *testing.T) {
 	mock.Result = nil
 	mock.err = nil
 
-	value, err = kvStorage.Get("value")
+	value, err = kvStorage.Get(ctx, "value")
 	if err == nil {
 		t.Error("Couln't get value for initialized value")
 	}
 
-	if value != "" {
+	if string(value) != "" {
 		t.Error("Unexpected get value for removed value")
 	}
 }
@@ -99,7 +114,7 @@ func TestHGetHSet(t *testing.T) {
 	mock.Result = nil
 	mock.err = nil
 
-	err := kvStorage.HSet("value", "name", "simulator")
+	err := kvStorage.HSet(ctx, "value", "name", "simulator")
 	if err != nil {
 		t.Error("Couln't hset value with field name and value simulator")
 	}
@@ -107,12 +122,12 @@ func TestHGetHSet(t *testing.T) {
 	mock.Result = "simulator"
 	mock.err = nil
 
-	value, err := kvStorage.HGet("value", "name")
+	value, err := kvStorage.HGet(ctx, "value", "name")
 	if err != nil {
 		t.Error("Couln't hget value for field name")
 	}
 
-	if value != "simulator" {
+	if string(value) != "simulator" {
 		t.Error("Unexpected hget value for field name")
 	}
 }
@@ -125,7 +140,7 @@ func TestHDel(t *testing.T) {
 	mock.Result = nil
 	mock.err = nil
 
-	err := kvStorage.HSet("value", "name", "simulator")
+	err := kvStorage.HSet(ctx, "value", "name", "simulator")
 	if err != nil {
 		t.Error("Couln't hset value with field name and value simulator")
 	}
@@ -133,19 +148,19 @@ func TestHDel(t *testing.T) {
 	mock.Result = "simulator"
 	mock.err = nil
 
-	value, err := kvStorage.HGet("value", "name")
+	value, err := kvStorage.HGet(ctx, "value", "name")
 	if err != nil {
 		t.Error("Couln't hget value for field name")
 	}
 
-	if value != "simulator" {
+	if string(value) != "simulator" {
 		t.Error("Unexpected hget value for field name")
 	}
 
 	mock.Result = nil
 	mock.err = nil
 
-	err = kvStorage.HDel("value", "name")
+	err = kvStorage.HDel(ctx, "value", "name")
 	if err != nil {
 		t.Error("Couln't del value")
 	}
@@ -159,7 +174,7 @@ func TestKeys(t *testing.T) {
 	mock.Result = nil
 	mock.err = fmt.Errorf("test-err")
 
-	k, err := kvStorage.Keys("*")
+	k, err := kvStorage.Keys(ctx, "*")
 	if err.Error() != "test-err" {
 		t.Errorf("keys error didnt match: %s (%v)", err.Error(), err)
 	}
@@ -167,3 +182,251 @@ func TestKeys(t *testing.T) {
 		t.Error("keys must be nil")
 	}
 }
+
+func TestScan(t *testing.T) {
+	mock := redisMock{}
+	kvStorage := Rediskv{}
+	kvStorage.redis = &mock
+
+	mock.Result = []interface{}{[]byte("17"), []interface{}{[]byte("key:1"), []byte("key:2")}}
+	cursor, keys, err := kvStorage.Scan(ctx, 0, "key:*", 2)
+	if err != nil {
+		t.Errorf("scan failed: %v", err)
+	}
+	if cursor != 17 {
+		t.Errorf("unexpected cursor: %d", cursor)
+	}
+	if len(keys) != 2 || keys[0] != "key:1" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+
+	mock.Result = []interface{}{[]byte("0"), []interface{}{[]byte("key:3")}}
+	keys, err = kvStorage.Keys(ctx, "key:*")
+	if err != nil {
+		t.Errorf("keys failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "key:3" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+
+	mock.Result = []interface{}{[]byte("0")}
+	_, _, err = kvStorage.Scan(ctx, 0, "*", 0)
+	if err == nil {
+		t.Error("invalid scan reply must fail")
+	}
+}
+
+func TestElementScan(t *testing.T) {
+	mock := redisMock{}
+	kvStorage := Rediskv{}
+	kvStorage.redis = &mock
+
+	mock.Result = []interface{}{[]byte("5"), []interface{}{[]byte("a"), []byte("1"), []byte("b"), []byte("2")}}
+	cursor, fields, err := kvStorage.HScan(ctx, "value", 0, "*", 2)
+	if err != nil {
+		t.Errorf("hscan failed: %v", err)
+	}
+	if cursor != 5 || len(fields) != 2 || fields[0] != "a" || fields[1] != "b" {
+		t.Errorf("unexpected fields: %d %v", cursor, fields)
+	}
+
+	mock.Result = []interface{}{[]byte("0"), []interface{}{[]byte("one"), []byte("1.5")}}
+	cursor, z, err := kvStorage.ZScan(ctx, "value", 5, "*", 2)
+	if err != nil {
+		t.Errorf("zscan failed: %v", err)
+	}
+	if cursor != 0 || len(z) != 1 || z[0].Member != "one" || z[0].Score != 1.5 {
+		t.Errorf("unexpected members: %d %v", cursor, z)
+	}
+
+	mock.Result = []interface{}{[]byte("a"), []byte("b")}
+	list, err := kvStorage.LRange(ctx, "value", 10, 2)
+	if err != nil || len(list) != 2 {
+		t.Errorf("unexpected elements: %v %v", list, err)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	mock := redisMock{}
+	kvStorage := Rediskv{}
+	kvStorage.redis = &mock
+
+	mock.Result = int64(1)
+	if err := kvStorage.Expire(ctx, "value", time.Minute); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	mock.Result = int64(0)
+	if err := kvStorage.Expire(ctx, "value", time.Minute); err == nil {
+		t.Error("Expire of a missing key must fail")
+	}
+
+	mock.Result = int64(-1)
+	if ttl, err := kvStorage.TTL(ctx, "value"); err != nil || ttl >= 0 {
+		t.Errorf("Unexpected TTL of a key without expiration: %v %v", ttl, err)
+	}
+	mock.Result = int64(1500)
+	if ttl, err := kvStorage.TTL(ctx, "value"); err != nil || ttl != 1500*time.Millisecond {
+		t.Errorf("Unexpected TTL: %v %v", ttl, err)
+	}
+	mock.Result = int64(-2)
+	if _, err := kvStorage.TTL(ctx, "value"); err == nil {
+		t.Error("TTL of a missing key must fail")
+	}
+}
+
+func TestSortedSet(t *testing.T) {
+	mock := redisMock{}
+	kvStorage := Rediskv{}
+	kvStorage.redis = &mock
+
+	mock.Result = "zset"
+	if tp, err := kvStorage.Type(ctx, "value"); err != nil || tp != types.KVTypeSortedSet {
+		t.Errorf("Unexpected type: %v %v", tp, err)
+	}
+
+	mock.Result = []interface{}{[]byte("one"), []byte("1"), []byte("two"), []byte("2.5")}
+	z, err := kvStorage.ZRangeWithScores(ctx, "value", 0, -1)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(z) != 2 || z[0].Member != "one" || z[0].Score != 1 || z[1].Member != "two" || z[1].Score != 2.5 {
+		t.Errorf("Unexpected members: %v", z)
+	}
+
+	mock.Result = []interface{}{[]byte("one")}
+	if _, err := kvStorage.ZRangeWithScores(ctx, "value", 0, -1); err == nil {
+		t.Error("An odd reply must fail")
+	}
+}
+
+func TestStream(t *testing.T) {
+	mock := redisMock{}
+	kvStorage := Rediskv{}
+	kvStorage.redis = &mock
+
+	mock.Result = "stream"
+	if tp, err := kvStorage.Type(ctx, "value"); err != nil || tp != types.KVTypeStream {
+		t.Errorf("Unexpected type: %v %v", tp, err)
+	}
+
+	mock.Result = []interface{}{
+		[]interface{}{[]byte("1-0"), []interface{}{[]byte("temp"), []byte("19.8")}},
+		[]interface{}{[]byte("2-0"), []interface{}{[]byte("temp"), []byte("20.1"), []byte("unit"), []byte("C")}},
+	}
+	msgs, err := kvStorage.XRange(ctx, "value", "-", "+", 10)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(msgs) != 2 || msgs[1].ID != "2-0" || len(msgs[1].Values) != 4 || msgs[1].Values[3] != "C" {
+		t.Errorf("Unexpected entries: %v", msgs)
+	}
+
+	mock.Result = []interface{}{
+		[]interface{}{[]byte("name"), []byte("workers"), []byte("consumers"), int64(2),
+			[]byte("pending"), int64(5), []byte("last-delivered-id"), []byte("2-0")},
+	}
+	groups, err := kvStorage.XInfoGroups(ctx, "value")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(groups) != 1 || groups[0].Name != "workers" || groups[0].Consumers != 2 || groups[0].Pending != 5 || groups[0].LastDeliveredID != "2-0" {
+		t.Errorf("Unexpected groups: %v", groups)
+	}
+
+	mock.Result = []interface{}{
+		[]interface{}{[]byte("name"), []byte("alice"), []byte("pending"), int64(3), []byte("idle"), int64(1500)},
+	}
+	consumers, err := kvStorage.XInfoConsumers(ctx, "value", "workers")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(consumers) != 1 || consumers[0].Name != "alice" || consumers[0].Pending != 3 || consumers[0].Idle != 1500*time.Millisecond {
+		t.Errorf("Unexpected consumers: %v", consumers)
+	}
+}
+
+func TestOptional(t *testing.T) {
+	var kvStorage interface{} = Rediskv{}
+	if _, ok := kvStorage.(kv.Streamer); !ok {
+		t.Error("Rediskv must implement kv.Streamer")
+	}
+	if _, ok := kvStorage.(kv.Dumper); !ok {
+		t.Error("Rediskv must implement kv.Dumper")
+	}
+	if _, ok := kvStorage.(kv.TTLBatcher); !ok {
+		t.Error("Rediskv must implement kv.TTLBatcher")
+	}
+}
+
+func TestTTLs(t *testing.T) {
+	ttls := map[string]string{"a": ":1500\r\n", "b": ":-1\r\n", "c": ":-2\r\n"}
+	s := newFakeServer(t, func(cmd []string) string {
+		switch {
+		case cmd[0] == "GET":
+			return array("value")[4:]
+		case cmd[0] == "PTTL" && ttls[cmd[1]] != "":
+			return ttls[cmd[1]]
+		}
+		return "-ERR unexpected\r\n"
+	})
+	defer s.l.Close()
+	kvStorage, err := New(s.l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kvStorage.Close()
+
+	got, err := kvStorage.TTLs(ctx, []string{"a", "b", "c", "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["a"] != 1500*time.Millisecond || got["b"] >= 0 {
+		t.Errorf("Unexpected TTLs: %v", got)
+	}
+	// all replies are read, the next command gets its own reply
+	if value, err := kvStorage.Get(ctx, "value"); err != nil || string(value) != "value" {
+		t.Errorf("Unexpected value after TTLs: %q %v", value, err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	// a server that accepts connections but never replies
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	kvStorage, err := New(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = kvStorage.Get(ctx, "value")
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("get did not honor the deadline")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = kvStorage.Get(ctx, "value")
+	if err != context.Canceled {
+		t.Errorf("expected canceled, got: %v", err)
+	}
+}
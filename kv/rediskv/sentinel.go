@@ -0,0 +1,252 @@
+package rediskv
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// sentinelTimeout is the timeout of connecting to and querying a sentinel
+const sentinelTimeout = 5 * time.Second
+
+// sentinel finds the primary or a replica of a master monitored by Redis
+// Sentinel for a link. It listens for failovers announced by the sentinels
+// and then connects the link to the new node, which selects the same
+// database. When the link reconnects it asks the sentinels for the node
+// again.
+type sentinel struct {
+	opts Options
+	link *link
+
+	mu sync.Mutex
+	// sentinels holds the addresses of the sentinels, the one that
+	// answered last comes first
+	sentinels []string
+	addr      string
+	sub       redis.Conn
+	closed    bool
+}
+
+// dialSentinel connects to the node named by the sentinels in opts
+func dialSentinel(opts *Options) (*Rediskv, error) {
+	s := &sentinel{
+		opts:      *opts,
+		sentinels: append([]string(nil), opts.Sentinels...),
+	}
+	l, err := newLink(s.dial, opts.DB, s.connected)
+	if err != nil {
+		return nil, err
+	}
+	s.link = l
+	go s.watch()
+	return &Rediskv{link: l, sentinel: s}, nil
+}
+
+// dial connects to the node the sentinels name
+func (s *sentinel) dial() (*Rediskv, error) {
+	addr, err := s.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return s.dialNode(addr)
+}
+
+// dialNode connects to the node at addr
+func (s *sentinel) dialNode(addr string) (*Rediskv, error) {
+	opts := s.opts
+	opts.Network, opts.Addr, opts.DB = "tcp", addr, 0
+	return dial(&opts)
+}
+
+// connected records the node of r as the node in use, the link calls it
+// once the connection to it replaced the previous one
+func (s *sentinel) connected(r *Rediskv) {
+	s.mu.Lock()
+	s.addr = r.addr
+	s.mu.Unlock()
+}
+
+// dialSentinels connects to the first sentinel that can be reached
+func (s *sentinel) dialSentinels(options ...redis.DialOption) (redis.Conn, error) {
+	options = append(options,
+		redis.DialConnectTimeout(sentinelTimeout),
+		redis.DialPassword(s.opts.SentinelPassword))
+	if s.opts.TLS != nil {
+		options = append(options, redis.DialUseTLS(true), redis.DialTLSConfig(s.opts.TLS))
+	}
+	s.mu.Lock()
+	sentinels := append([]string(nil), s.sentinels...)
+	s.mu.Unlock()
+	var errs []string
+	for _, addr := range sentinels {
+		c, err := redis.Dial("tcp", addr, options...)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		// ask this one first next time
+		s.mu.Lock()
+		for i, a := range s.sentinels {
+			if a == addr {
+				copy(s.sentinels[1:i+1], s.sentinels[:i])
+				s.sentinels[0] = addr
+				break
+			}
+		}
+		s.mu.Unlock()
+		return c, nil
+	}
+	return nil, fmt.Errorf("redis: no sentinel reachable: %s", strings.Join(errs, ", "))
+}
+
+// resolve asks the sentinels for the address of the primary of the master,
+// or of a replica that is up
+func (s *sentinel) resolve() (string, error) {
+	c, err := s.dialSentinels(redis.DialReadTimeout(sentinelTimeout), redis.DialWriteTimeout(sentinelTimeout))
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	if !s.opts.Replica {
+		addr, err := redis.Strings(c.Do("SENTINEL", "get-master-addr-by-name", s.opts.Master))
+		if err == redis.ErrNil || (err == nil && len(addr) != 2) {
+			return "", fmt.Errorf("redis: sentinels do not know master %s", s.opts.Master)
+		}
+		if err != nil {
+			return "", err
+		}
+		return net.JoinHostPort(addr[0], addr[1]), nil
+	}
+	replicas, err := redis.Values(c.Do("SENTINEL", "slaves", s.opts.Master))
+	if err != nil {
+		return "", err
+	}
+	for _, r := range replicas {
+		info, err := redis.StringMap(r, nil)
+		if err != nil {
+			return "", err
+		}
+		if down(info["flags"]) {
+			continue
+		}
+		return net.JoinHostPort(info["ip"], info["port"]), nil
+	}
+	return "", fmt.Errorf("redis: no replica of %s is up", s.opts.Master)
+}
+
+// down reports whether the flags of a node reported by a sentinel tell it
+// is not available
+func down(flags string) bool {
+	for _, f := range strings.Split(flags, ",") {
+		switch f {
+		case "s_down", "o_down", "disconnected":
+			return true
+		}
+	}
+	return false
+}
+
+// connect replaces the connection of the link by one to the node at addr
+func (s *sentinel) connect(addr string) error {
+	r, err := s.dialNode(addr)
+	if err != nil {
+		return err
+	}
+	return s.link.swap(r)
+}
+
+// watch follows the failovers of the master. When the connection to the
+// sentinel breaks it waits a second, connects to another one and resolves
+// the node again, as a failover could have been missed.
+func (s *sentinel) watch() {
+	for {
+		s.subscribe()
+		time.Sleep(time.Second)
+		if s.isClosed() {
+			return
+		}
+		if addr, err := s.resolve(); err == nil && addr != s.address() {
+			s.connect(addr)
+		}
+	}
+}
+
+// subscribe listens for +switch-master announcements of a sentinel until
+// its connection breaks
+func (s *sentinel) subscribe() error {
+	c, err := s.dialSentinels()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return c.Close()
+	}
+	s.sub = c
+	s.mu.Unlock()
+
+	psc := redis.PubSubConn{Conn: c}
+	defer psc.Close()
+	if err := psc.Subscribe("+switch-master"); err != nil {
+		return err
+	}
+	for {
+		switch m := psc.Receive().(type) {
+		case redis.Message:
+			// <master> <old ip> <old port> <new ip> <new port>
+			f := strings.Fields(string(m.Data))
+			if len(f) != 5 || f[0] != s.opts.Master {
+				continue
+			}
+			addr := net.JoinHostPort(f[3], f[4])
+			if s.opts.Replica {
+				if addr, err = s.resolve(); err != nil {
+					return err
+				}
+			}
+			if err := s.connect(addr); err != nil {
+				return err
+			}
+		case error:
+			return m
+		}
+	}
+}
+
+// address returns the address of the node in use
+func (s *sentinel) address() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addr
+}
+
+// node describes the node in use, like "primary 10.0.0.1:6379 of cache"
+func (s *sentinel) node() string {
+	role := "primary"
+	if s.opts.Replica {
+		role = "replica"
+	}
+	return fmt.Sprintf("%s %s of %s", role, s.address(), s.opts.Master)
+}
+
+func (s *sentinel) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// close stops watching the sentinels
+func (s *sentinel) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.sub == nil {
+		return nil
+	}
+	return s.sub.Close()
+}
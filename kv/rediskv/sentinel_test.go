@@ -0,0 +1,181 @@
+package rediskv
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// array returns the reply of an array of bulk strings
+func array(elems ...string) string {
+	s := fmt.Sprintf("*%d\r\n", len(elems))
+	for _, e := range elems {
+		s += fmt.Sprintf("$%d\r\n%s\r\n", len(e), e)
+	}
+	return s
+}
+
+// fakeNode is a Redis server replying to GET with its name
+func fakeNode(t *testing.T, name string) *fakeServer {
+	return newFakeServer(t, func(cmd []string) string {
+		if cmd[0] == "GET" {
+			return array(name)[4:]
+		}
+		return "+OK\r\n"
+	})
+}
+
+// fakeSentinel is a Redis Sentinel monitoring master cache
+type fakeSentinel struct {
+	*fakeServer
+
+	mu       sync.Mutex
+	primary  string
+	replicas []string
+}
+
+func newFakeSentinel(t *testing.T, primary string, replicas ...string) *fakeSentinel {
+	s := &fakeSentinel{primary: primary, replicas: replicas}
+	s.fakeServer = newFakeServer(t, func(cmd []string) string {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch {
+		case cmd[0] == "SUBSCRIBE":
+			return "*3\r\n" + array("subscribe", cmd[1])[4:] + ":1\r\n"
+		case len(cmd) != 3 || cmd[0] != "SENTINEL":
+			return "-ERR unknown command\r\n"
+		case cmd[2] != "cache":
+			return "*-1\r\n"
+		case cmd[1] == "get-master-addr-by-name":
+			host, port, _ := net.SplitHostPort(s.primary)
+			return array(host, port)
+		case cmd[1] == "slaves":
+			reply := fmt.Sprintf("*%d\r\n", len(s.replicas))
+			for i, r := range s.replicas {
+				host, port, _ := net.SplitHostPort(r)
+				flags := "slave"
+				if i == 0 {
+					flags = "slave,s_down"
+				}
+				reply += array("ip", host, "port", port, "flags", flags)
+			}
+			return reply
+		}
+		return "-ERR unknown subcommand\r\n"
+	})
+	return s
+}
+
+// failover makes primary the primary and announces it
+func (s *fakeSentinel) failover(primary string) {
+	s.mu.Lock()
+	old := strings.Replace(s.primary, ":", " ", 1)
+	s.primary = primary
+	s.mu.Unlock()
+	msg := "cache " + old + " " + strings.Replace(primary, ":", " ", 1)
+	s.push("*3\r\n" + array("message", "+switch-master", msg)[4:])
+}
+
+func TestSentinel(t *testing.T) {
+	a, b := fakeNode(t, "a"), fakeNode(t, "b")
+	defer a.l.Close()
+	defer b.l.Close()
+	s := newFakeSentinel(t, a.l.Addr().String())
+	defer s.l.Close()
+
+	// the first sentinel is down
+	down, _ := net.Listen("tcp", "127.0.0.1:0")
+	down.Close()
+
+	kvStorage, err := New("redis+sentinel://" + down.Addr().String() + "," + s.l.Addr().String() + "/cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kvStorage.Close()
+	if node := kvStorage.Node(); node != "primary "+a.l.Addr().String()+" of cache" {
+		t.Errorf("unexpected node: %s", node)
+	}
+	if err := kvStorage.Database(ctx, 2); err != nil {
+		t.Error(err)
+	}
+	if value, err := kvStorage.Get(ctx, "value"); err != nil || string(value) != "a" {
+		t.Errorf("unexpected value before failover: %q %v", value, err)
+	}
+
+	// wait for the subscription before announcing the failover
+	for i := 0; i < 100 && len(s.commands()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.failover(b.l.Addr().String())
+	for i := 0; i < 100 && kvStorage.Node() == "primary "+a.l.Addr().String()+" of cache"; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if node := kvStorage.Node(); node != "primary "+b.l.Addr().String()+" of cache" {
+		t.Fatalf("node not switched: %s", node)
+	}
+	if value, err := kvStorage.Get(ctx, "value"); err != nil || string(value) != "b" {
+		t.Errorf("unexpected value after failover: %q %v", value, err)
+	}
+	if cmds := b.commands(); len(cmds) == 0 || cmds[0] != "SELECT 2" {
+		t.Errorf("database not selected after failover: %q", cmds)
+	}
+}
+
+func TestSentinelReplica(t *testing.T) {
+	a, b := fakeNode(t, "a"), fakeNode(t, "b")
+	defer a.l.Close()
+	defer b.l.Close()
+	s := newFakeSentinel(t, "127.0.0.1:1", a.l.Addr().String(), b.l.Addr().String())
+	defer s.l.Close()
+
+	kvStorage, err := New("redis+sentinel://" + s.l.Addr().String() + "/cache?replica=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kvStorage.Close()
+	// a is down
+	if node := kvStorage.Node(); node != "replica "+b.l.Addr().String()+" of cache" {
+		t.Errorf("unexpected node: %s", node)
+	}
+
+	if _, err := New("redis+sentinel://" + s.l.Addr().String() + "/other"); err == nil {
+		t.Error("unknown masters must fail")
+	}
+}
+
+func TestSentinelFailedSwap(t *testing.T) {
+	a := fakeNode(t, "a")
+	defer a.l.Close()
+	// c refuses to select the database
+	c := newFakeServer(t, func(cmd []string) string {
+		if cmd[0] == "SELECT" {
+			return "-ERR DB index is out of range\r\n"
+		}
+		return "+OK\r\n"
+	})
+	defer c.l.Close()
+	s := newFakeSentinel(t, a.l.Addr().String())
+	defer s.l.Close()
+
+	opts, err := ParseURL("redis+sentinel://" + s.l.Addr().String() + "/cache/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := dialSentinel(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.sentinel.connect(c.l.Addr().String()); err == nil {
+		t.Error("connecting to a node that cannot select the database must fail")
+	}
+	if addr := r.sentinel.address(); addr != a.l.Addr().String() {
+		t.Errorf("node in use recorded as %s, want %s", addr, a.l.Addr().String())
+	}
+	if value, err := r.Get(ctx, "value"); err != nil || string(value) != "a" {
+		t.Errorf("unexpected value after the failed switch: %q %v", value, err)
+	}
+}
@@ -0,0 +1,181 @@
+package rediskv
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Options are the options to connect to a Redis server with
+type Options struct {
+	// Network is tcp or unix, Addr is host:port or the path of the socket
+	Network string
+	Addr    string
+	// Username and Password are sent with AUTH when Password is set, the
+	// username is only sent when it is set (Redis 6 ACL)
+	Username string
+	Password string
+	// DB is the database selected after connecting
+	DB int
+	// TLS is the TLS configuration, nil to connect without TLS
+	TLS *tls.Config
+
+	// Sentinels are the addresses of the Redis Sentinels monitoring Master,
+	// when set they are asked for the node to connect to: the primary or,
+	// with Replica, a replica
+	Sentinels        []string
+	Master           string
+	Replica          bool
+	SentinelPassword string
+
+	// Cluster are the addresses of nodes of a Redis Cluster, the other
+	// nodes are discovered from these
+	Cluster []string
+}
+
+// ParseURL parses the connection parameters of a Redis server. These are a
+// host:port address or an URL like:
+//
+//	redis://[user[:password]@]host[:port][/db]
+//	rediss://[user[:password]@]host[:port][/db][?ca=file&cert=file&key=file]
+//	unix://[user[:password]@]/path/to/socket[?db=db]
+//	redis+sentinel://[user[:password]@]host[:port][,host[:port]...]/master[/db]
+//	redis+cluster://[user[:password]@]host[:port][,host[:port]...]
+//
+// rediss:// connects with TLS, it verifies the server with the CA
+// certificates in ca or else with those of the system. cert and key are the
+// client certificate and its key, insecure=true skips the verification of
+// the server and servername sets the name the server is verified against.
+//
+// redis+sentinel:// (or rediss+sentinel:// for TLS) asks the sentinels at
+// the given addresses for the primary of master, or for a replica with
+// replica=true. The sentinels themselves are authenticated with
+// sentinel_password.
+//
+// redis+cluster:// (or rediss+cluster:// for TLS) connects to the Redis
+// Cluster the nodes at the given addresses are part of.
+func ParseURL(params string) (*Options, error) {
+	if !strings.Contains(params, "://") {
+		return &Options{Network: "tcp", Addr: params}, nil
+	}
+	u, err := url.Parse(params)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	opts := &Options{Network: "tcp"}
+	scheme, path := u.Scheme, u.Path
+	if strings.HasSuffix(scheme, "+sentinel") {
+		scheme = strings.TrimSuffix(scheme, "+sentinel")
+		if path, err = parseSentinel(u, opts); err != nil {
+			return nil, err
+		}
+		opts.Replica = q.Get("replica") == "true"
+		opts.SentinelPassword = q.Get("sentinel_password")
+	} else if strings.HasSuffix(scheme, "+cluster") {
+		scheme = strings.TrimSuffix(scheme, "+cluster")
+		for _, host := range strings.Split(u.Host, ",") {
+			opts.Cluster = append(opts.Cluster, hostPort(host, "6379"))
+		}
+		if path != "" && path != "/" {
+			return nil, fmt.Errorf("redis: a cluster has no databases")
+		}
+	}
+	switch scheme {
+	case "redis", "rediss":
+		if opts.Sentinels == nil && opts.Cluster == nil {
+			opts.Addr = hostPort(u.Host, "6379")
+		}
+		if db := strings.Trim(path, "/"); db != "" {
+			q.Set("db", db)
+		}
+	case "unix":
+		opts.Network = "unix"
+		opts.Addr = u.Path
+		if opts.Addr == "" {
+			return nil, fmt.Errorf("redis: no socket path in %s", params)
+		}
+	default:
+		return nil, fmt.Errorf("redis: invalid URL scheme: %s", u.Scheme)
+	}
+	if u.User != nil {
+		opts.Username = u.User.Username()
+		opts.Password, _ = u.User.Password()
+	}
+	if db := q.Get("db"); db != "" {
+		if opts.DB, err = strconv.Atoi(db); err != nil || opts.DB < 0 {
+			return nil, fmt.Errorf("redis: invalid database: %s", db)
+		}
+	}
+	if scheme == "rediss" {
+		if opts.TLS, err = tlsConfig(q); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// hostPort returns host with the default port when it has none, an empty
+// host is localhost
+func hostPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, port)
+	}
+	if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+	return host
+}
+
+// parseSentinel sets the sentinel addresses and master name of u on opts,
+// it returns the rest of the path of u
+func parseSentinel(u *url.URL, opts *Options) (string, error) {
+	for _, host := range strings.Split(u.Host, ",") {
+		opts.Sentinels = append(opts.Sentinels, hostPort(host, "26379"))
+	}
+	// the path is /master[/db]
+	path := strings.SplitN(strings.Trim(u.Path, "/"), "/", 2)
+	if opts.Master = path[0]; opts.Master == "" {
+		return "", fmt.Errorf("redis: no master name in %s", u)
+	}
+	if len(path) == 1 {
+		return "", nil
+	}
+	return path[1], nil
+}
+
+// tlsConfig returns the TLS configuration for the options in q
+func tlsConfig(q url.Values) (*tls.Config, error) {
+	c := &tls.Config{
+		ServerName:         q.Get("servername"),
+		InsecureSkipVerify: q.Get("insecure") == "true",
+	}
+	if ca := q.Get("ca"); ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("redis: no certificates in %s", ca)
+		}
+	}
+	cert, key := q.Get("cert"), q.Get("key")
+	if cert != "" || key != "" {
+		if key == "" {
+			// the key is often in the same file as the certificate
+			key = cert
+		}
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{pair}
+	}
+	return c, nil
+}
@@ -0,0 +1,79 @@
+package kv
+
+import "context"
+
+// DefaultScanCount is the page size used when no COUNT hint is given
+const DefaultScanCount = 10
+
+// KeyIterator walks over the keys of a KV-store page by page using Scan.
+// A Scan cursor of 0 starts the iteration and a returned cursor of 0
+// marks its end, like the Redis SCAN command.
+type KeyIterator struct {
+	store   KV
+	pattern string
+	count   int
+	cursor  uint64
+	started bool
+	keys    []string
+	err     error
+}
+
+// NewKeyIterator returns an iterator over the keys matched by pattern,
+// count is a hint for the number of keys fetched per page
+func NewKeyIterator(store KV, pattern string, count int) *KeyIterator {
+	if count <= 0 {
+		count = DefaultScanCount
+	}
+	return &KeyIterator{store: store, pattern: pattern, count: count}
+}
+
+// Next fetches the next page of keys, a single Scan round. The page can be
+// empty when no keys in the round matched the pattern. It returns false when
+// the iteration is done or an error occurred.
+func (it *KeyIterator) Next(ctx context.Context) bool {
+	it.keys = nil
+	if it.err != nil || it.Done() {
+		return false
+	}
+	cursor, keys, err := it.store.Scan(ctx, it.cursor, it.pattern, it.count)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.started = true
+	it.cursor = cursor
+	it.keys = keys
+	return true
+}
+
+// Keys returns the page of keys fetched by the last call to Next
+func (it *KeyIterator) Keys() []string {
+	return it.keys
+}
+
+// Done reports whether all pages are fetched
+func (it *KeyIterator) Done() bool {
+	return it.started && it.cursor == 0
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *KeyIterator) Err() error {
+	return it.err
+}
+
+// ScanSlice returns a page of at most count keys starting at cursor from
+// keys, for backends that can not iterate incrementally. The cursor is
+// the offset in keys, so keys should be sorted.
+func ScanSlice(keys []string, cursor uint64, count int) (uint64, []string) {
+	if count <= 0 {
+		count = DefaultScanCount
+	}
+	if cursor >= uint64(len(keys)) {
+		return 0, nil
+	}
+	end := cursor + uint64(count)
+	if end >= uint64(len(keys)) {
+		return 0, keys[cursor:]
+	}
+	return end, keys[cursor:end]
+}
@@ -0,0 +1,90 @@
+package kv_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/ramkv"
+)
+
+var ctx = context.Background()
+
+func TestScanSlice(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e"}
+
+	cursor, page := kv.ScanSlice(keys, 0, 2)
+	if cursor != 2 || len(page) != 2 || page[0] != "a" {
+		t.Errorf("Unexpected first page: %d %v", cursor, page)
+	}
+	cursor, page = kv.ScanSlice(keys, cursor, 2)
+	if cursor != 4 || len(page) != 2 || page[0] != "c" {
+		t.Errorf("Unexpected second page: %d %v", cursor, page)
+	}
+	cursor, page = kv.ScanSlice(keys, cursor, 2)
+	if cursor != 0 || len(page) != 1 || page[0] != "e" {
+		t.Errorf("Unexpected last page: %d %v", cursor, page)
+	}
+	cursor, page = kv.ScanSlice(keys, 10, 2)
+	if cursor != 0 || page != nil {
+		t.Errorf("Unexpected page beyond end: %d %v", cursor, page)
+	}
+}
+
+func TestKeyIterator(t *testing.T) {
+	r, _ := ramkv.New()
+	for i := 0; i < 25; i++ {
+		r.Set(ctx, fmt.Sprintf("key:%02d", i), i)
+	}
+	r.Set(ctx, "other", "x")
+
+	it := kv.NewKeyIterator(r, "key:*", 10)
+	var keys []string
+	pages := 0
+	for it.Next(ctx) {
+		keys = append(keys, it.Keys()...)
+		pages++
+	}
+	if it.Err() != nil {
+		t.Errorf("Unexpected error: %v", it.Err())
+	}
+	if !it.Done() {
+		t.Error("Iterator must be done")
+	}
+	if len(keys) != 25 {
+		t.Errorf("Expected 25 keys, got %d", len(keys))
+	}
+	if pages != 3 {
+		t.Errorf("Expected 3 pages, got %d", pages)
+	}
+	if it.Next(ctx) {
+		t.Error("Next must return false when done")
+	}
+}
+
+// sparseStore returns a matching key only in the last of its Scan rounds
+type sparseStore struct {
+	kv.KV
+	rounds uint64
+}
+
+func (s *sparseStore) Scan(ctx context.Context, cursor uint64, pattern string, count int) (uint64, []string, error) {
+	if cursor+1 == s.rounds {
+		return 0, []string{"match"}, nil
+	}
+	return cursor + 1, nil, nil
+}
+
+func TestKeyIteratorEmptyRounds(t *testing.T) {
+	it := kv.NewKeyIterator(&sparseStore{rounds: 3}, "match", 10)
+	// every call to Next is a single Scan round
+	for i := 0; i < 2; i++ {
+		if !it.Next(ctx) || len(it.Keys()) != 0 || it.Done() {
+			t.Fatalf("round %d must return an empty page: %v %v", i, it.Keys(), it.Err())
+		}
+	}
+	if !it.Next(ctx) || len(it.Keys()) != 1 || !it.Done() {
+		t.Errorf("the last round must return the key: %v %v", it.Keys(), it.Err())
+	}
+}
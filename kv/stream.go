@@ -0,0 +1,55 @@
+package kv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseStreamID splits a stream ID in its milliseconds and sequence parts
+func parseStreamID(id string) (ms, seq uint64, err error) {
+	parts := strings.SplitN(id, "-", 2)
+	if ms, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid stream ID: %s", id)
+	}
+	if len(parts) == 2 {
+		if seq, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid stream ID: %s", id)
+		}
+	}
+	return ms, seq, nil
+}
+
+// NextStreamID returns the lowest stream ID after id, it is used as start
+// of the next page when paging with XRange
+func NextStreamID(id string) (string, error) {
+	ms, seq, err := parseStreamID(id)
+	if err != nil {
+		return "", err
+	}
+	if seq == ^uint64(0) {
+		ms, seq = ms+1, 0
+	} else {
+		seq++
+	}
+	return fmt.Sprintf("%d-%d", ms, seq), nil
+}
+
+// PrevStreamID returns the highest stream ID before id, it is used as end
+// of the next page when paging with XRevRange. There is no ID before
+// "0-0", in that case PrevStreamID returns "".
+func PrevStreamID(id string) (string, error) {
+	ms, seq, err := parseStreamID(id)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case seq > 0:
+		seq--
+	case ms > 0:
+		ms, seq = ms-1, ^uint64(0)
+	default:
+		return "", nil
+	}
+	return fmt.Sprintf("%d-%d", ms, seq), nil
+}
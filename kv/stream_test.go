@@ -0,0 +1,34 @@
+package kv_test
+
+import (
+	"testing"
+
+	"github.com/rikvdh/kvui/kv"
+)
+
+func TestStreamIDs(t *testing.T) {
+	tests := []struct {
+		id   string
+		next string
+		prev string
+	}{
+		{"1526919030474-55", "1526919030474-56", "1526919030474-54"},
+		{"1526919030474-0", "1526919030474-1", "1526919030473-18446744073709551615"},
+		{"1526919030474", "1526919030474-1", "1526919030473-18446744073709551615"},
+		{"5-18446744073709551615", "6-0", "5-18446744073709551614"},
+		{"0-0", "0-1", ""},
+	}
+
+	for _, tt := range tests {
+		if next, err := kv.NextStreamID(tt.id); err != nil || next != tt.next {
+			t.Errorf("NextStreamID(%q) = %q, %v, expected %q", tt.id, next, err, tt.next)
+		}
+		if prev, err := kv.PrevStreamID(tt.id); err != nil || prev != tt.prev {
+			t.Errorf("PrevStreamID(%q) = %q, %v, expected %q", tt.id, prev, err, tt.prev)
+		}
+	}
+
+	if _, err := kv.NextStreamID("invalid"); err == nil {
+		t.Error("NextStreamID of an invalid ID must fail")
+	}
+}
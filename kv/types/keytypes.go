@@ -3,10 +3,13 @@ package types
 type KVType int
 
 const (
-	KVTypeInvalid KVType = -1
-	KVTypeString  KVType = 0
-	KVTypeMap     KVType = 1
-	KVTypeList    KVType = 2
+	KVTypeInvalid   KVType = -1
+	KVTypeString    KVType = 0
+	KVTypeMap       KVType = 1
+	KVTypeList      KVType = 2
+	KVTypeSet       KVType = 3
+	KVTypeSortedSet KVType = 4
+	KVTypeStream    KVType = 5
 )
 
 func (k KVType) String() string {
@@ -17,6 +20,12 @@ func (k KVType) String() string {
 		return "map"
 	case KVTypeList:
 		return "list"
+	case KVTypeSet:
+		return "set"
+	case KVTypeSortedSet:
+		return "sorted set"
+	case KVTypeStream:
+		return "stream"
 	}
 	return "<invalid>"
 }
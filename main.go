@@ -5,32 +5,201 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/jroimartin/gocui"
 	"github.com/rikvdh/kvui/kv"
+	_ "github.com/rikvdh/kvui/kv/boltkv"
+	_ "github.com/rikvdh/kvui/kv/memcachedkv"
+	_ "github.com/rikvdh/kvui/kv/ramkv"
+	_ "github.com/rikvdh/kvui/kv/rediskv"
 )
 
 var (
-	no256    = flag.Bool("no256", false, "Disable 256-color")
-	host     = flag.String("h", "localhost", "Host to connect to")
-	port     = flag.Uint("p", 6379, "Port to connect to")
-	kvtype   = flag.String("type", "redis", "KV-storage type")
-	kvstore  kv.KV
-	treeSize int
+	no256     = flag.Bool("no256", false, "Disable 256-color")
+	host      = flag.String("h", "localhost", "Host to connect to")
+	port      = flag.Uint("p", 6379, "Port to connect to")
+	rawURL    = flag.String("url", "", "URL to connect to (redis://, rediss://, unix://, redis+sentinel:// or redis+cluster://), overrides -h and -p")
+	file      = flag.String("file", "", "Database file to open (file based KV-storages like bolt)")
+	pageSize  = flag.Int("pagesize", 100, "Number of keys or elements fetched per page")
+	timeout   = flag.Duration("timeout", 5*time.Second, "Timeout for a single KV-storage operation")
+	delimiter = flag.String("delim", ":", "Delimiter used to group keys in namespaces, empty to disable")
+	kvtype    = flag.String("type", kv.TypeRedis, "KV-storage type ("+strings.Join(kv.Drivers(), ", ")+")")
+	cfgFile   = flag.String("config", defaultConfigFile(), "Configuration file")
+	profName  = flag.String("profile", "", "Profiles of the configuration file to connect with, comma separated to open several tabs")
+	roFlag    = flag.Bool("readonly", false, "Refuse editing, creating and deleting keys")
+	cfg       *config
+	kvstore   kv.KV
+	kvfetch   *fetcher
+	treeSize  int
+	// readOnly refuses changes to kvstore, set by -readonly or the profile
+	readOnly bool
 )
 
+// connectionFlags are the flags telling what to connect to
+var connectionFlags = map[string]bool{"h": true, "p": true, "url": true, "file": true, "type": true}
+
+// opContext returns the context for KV-storage operations, it expires
+// after the configured timeout
+func opContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), *timeout)
+}
+
+// writable reports whether the KV-store may be changed, it shows an error
+// when it is read-only
+func writable(g *gocui.Gui) bool {
+	if readOnly {
+		showError(g, errors.New("read-only connection"))
+	}
+	return !readOnly
+}
+
+// keybindings holds the key bindings of the views. Keys are bound to the
+// views they act on, so they don't end up in the prompt while typing.
+var keybindings = []struct {
+	view    string
+	key     interface{}
+	handler func(*gocui.Gui, *gocui.View) error
+}{
+	{"", gocui.KeyCtrlC, exit},
+	{treeView, gocui.KeyArrowRight, switchViewRight},
+	{valueView, gocui.KeyArrowLeft, switchViewLeft},
+	{treeView, gocui.KeyArrowUp, cursorUp},
+	{valueView, gocui.KeyArrowUp, cursorUp},
+	{treeView, gocui.KeyArrowDown, cursorDown},
+	{valueView, gocui.KeyArrowDown, cursorDown},
+	{valueView, gocui.KeyPgup, pageUp},
+	{valueView, gocui.KeyPgdn, pageDown},
+	{treeView, gocui.KeySpace, treeSelect},
+	{valueView, gocui.KeySpace, toggleFold},
+	{treeView, 'r', toggleRaw},
+	{valueView, 'r', toggleRaw},
+	{treeView, 'c', cycleDecoder},
+	{valueView, 'c', cycleDecoder},
+	{treeView, 'x', toggleHex},
+	{valueView, 'x', toggleHex},
+	{treeView, '/', filterKeys},
+	{treeView, 'n', nextMatch},
+	{treeView, 'N', prevMatch},
+	{promptView, gocui.KeyEnter, promptConfirm},
+	{promptView, gocui.KeyEsc, promptCancel},
+	{confirmView, 'y', confirmAccept},
+	{confirmView, 'n', confirmReject},
+	{confirmView, gocui.KeyEsc, confirmReject},
+	{treeView, 'e', editValue},
+	{valueView, 'e', editValue},
+	{editView, gocui.KeyCtrlS, editSave},
+	{editView, gocui.KeyEsc, editCancel},
+	{treeView, 'a', createKey},
+	{createView, gocui.KeyCtrlS, createSave},
+	{createView, gocui.KeyEsc, createCancel},
+	{treeView, 'd', deleteValue},
+	{valueView, 'd', deleteValue},
+	{treeView, 'u', undoDelete},
+	{valueView, 'u', undoDelete},
+	{treeView, 't', editTTL},
+	{valueView, 't', editTTL},
+	{treeView, 's', toggleSort},
+	{valueView, 's', toggleSort},
+	{profilesView, gocui.KeyArrowUp, cursorUp},
+	{profilesView, gocui.KeyArrowDown, cursorDown},
+	{profilesView, gocui.KeyEnter, pickProfile},
+	{profilesView, gocui.KeyEsc, closeProfiles},
+	{treeView, 'g', pressG},
+	{valueView, 'g', pressG},
+	{treeView, 'T', nothing},
+	{valueView, 'T', nothing},
+	{treeView, 'o', openTab},
+	{treeView, gocui.KeyCtrlW, closeTab},
+	{valueView, gocui.KeyCtrlW, closeTab},
+}
+
+// nothing is bound to keys that only do something after another key, like
+// T of gT
+func nothing(g *gocui.Gui, v *gocui.View) error {
+	return nil
+}
+
 func exit(g *gocui.Gui, v *gocui.View) error {
 	return gocui.ErrQuit
 }
 
+func cursorUp(g *gocui.Gui, v *gocui.View) error {
+	return moveCursor(g, v, -1)
+}
+
+func cursorDown(g *gocui.Gui, v *gocui.View) error {
+	return moveCursor(g, v, 1)
+}
+
+func pageUp(g *gocui.Gui, v *gocui.View) error {
+	_, h := v.Size()
+	return moveCursor(g, v, -h)
+}
+
+func pageDown(g *gocui.Gui, v *gocui.View) error {
+	_, h := v.Size()
+	return moveCursor(g, v, h)
+}
+
+// moveCursor moves the cursor n lines, in the value view of paged values
+// it moves the selected element
+func moveCursor(g *gocui.Gui, v *gocui.View, n int) error {
+	if v.Name() == valueView && currentValue != nil && paged(currentValue.t) {
+		return scrollElements(g, n)
+	}
+	for ; n < 0; n++ {
+		v.MoveCursor(0, -1, true)
+	}
+	for ; n > 0; n-- {
+		v.MoveCursor(0, 1, true)
+	}
+	return redraw(g, v)
+}
+
 func main() {
 	flag.Parse()
+	var err error
+	if cfg, err = loadConfig(*cfgFile); err != nil {
+		panic(err)
+	}
+	// the profile is picked in the UI when none of the flags tells what to
+	// connect to
+	named := false
+	flag.Visit(func(f *flag.Flag) {
+		named = named || connectionFlags[f.Name]
+	})
+	var names []string
+	profiles := make(map[string]*profile)
+	switch {
+	case *profName != "":
+		for _, name := range strings.Split(*profName, ",") {
+			if profiles[name] = cfg.Profiles[name]; profiles[name] == nil {
+				panic(fmt.Errorf("unknown profile: %s", name))
+			}
+			names = append(names, name)
+		}
+	case named || len(cfg.Profiles) == 0:
+		p := &profile{Type: *kvtype, URL: *rawURL, Host: *host, Port: *port, File: *file}
+		names = []string{p.describe()}
+		profiles[names[0]] = p
+	}
+	stores := make([]kv.KV, len(names))
+	for i, name := range names {
+		if stores[i], err = connect(profiles[name]); err != nil {
+			panic(err)
+		}
+	}
+
 	c := gocui.Output256
 	if *no256 {
 		c = gocui.OutputNormal
@@ -41,78 +210,122 @@ func main() {
 	}
 	defer g.Close()
 
-	kvstore, err = kv.New(*kvtype, fmt.Sprintf("%s:%d", *host, *port))
-	if err != nil {
-		panic(err)
-	}
-
 	log.SetOutput(os.Stderr)
 	g.SetManagerFunc(renderLayout)
 	g.SelFgColor = gocui.ColorYellow
 	g.Highlight = true
 	g.Cursor = true
+	g.InputEsc = true
 
-	if err := g.SetKeybinding("", gocui.KeyCtrlC, gocui.ModNone, exit); err != nil {
-		panic(err)
+	for _, kb := range keybindings {
+		if err := g.SetKeybinding(kb.view, kb.key, gocui.ModNone, withG(kb.key, kb.handler)); err != nil {
+			panic(err)
+		}
 	}
-	if err := g.SetKeybinding("", gocui.KeyArrowRight, gocui.ModNone, switchViewRight); err != nil {
+
+	for i, name := range names {
+		if err := open(g, name, profiles[name], stores[i]); err != nil {
+			panic(err)
+		}
+	}
+	if len(names) == 0 {
+		// started without arguments, pick a profile
+		err = showProfiles(g)
+	} else {
+		err = showTab(g, 0)
+	}
+	if err != nil {
 		panic(err)
 	}
-	if err := g.SetKeybinding("", gocui.KeyArrowLeft, gocui.ModNone, switchViewLeft); err != nil {
+	go func() {
+		tm := time.NewTicker(time.Second)
+		for range tm.C {
+			g.Update(func(g *gocui.Gui) error {
+				if kvstore == nil {
+					return nil
+				}
+				loadStatus(g)
+				if len(expiries) > 0 {
+					// count down the TTLs
+					redrawView(g, treeView)
+					redrawView(g, valueView)
+				}
+				return nil
+			})
+		}
+	}()
+
+	if err := g.MainLoop(); err != nil && err != gocui.ErrQuit {
 		panic(err)
 	}
-	if err := g.SetKeybinding("", gocui.KeySpace, gocui.ModNone, dbSelect); err != nil {
-		log.Fatalf("error: %v", err)
+}
+
+// connect connects to the KV-store of p and selects its database
+func connect(p *profile) (kv.KV, error) {
+	params, err := p.params()
+	if err != nil {
+		return nil, err
 	}
-	if err := g.SetKeybinding("", gocui.KeyArrowUp, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
-		v.MoveCursor(0, -1, true)
-		return redraw(g, v)
-	}); err != nil {
-		panic(err)
+	store, err := kv.New(p.kvType(), params)
+	if err != nil {
+		return nil, err
 	}
-	if err := g.SetKeybinding("", gocui.KeyArrowDown, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
-		v.MoveCursor(0, 1, true)
-		return redraw(g, v)
-	}); err != nil {
-		panic(err)
+	if p.DB != 0 {
+		ctx, cancel := opContext()
+		defer cancel()
+		if err := store.Database(ctx, p.DB); err != nil {
+			if c, ok := store.(io.Closer); ok {
+				c.Close()
+			}
+			return nil, err
+		}
 	}
+	return store, nil
+}
+
+// open shows store, connected with profile p, in a new tab
+func open(g *gocui.Gui, name string, p *profile, store kv.KV) error {
+	addTab(g, name, store)
+	c := *cfg
+	c.Decoders = append(append([]decoderRule(nil), p.Decoders...), cfg.Decoders...)
+	if err := setupDecoders(&c); err != nil {
+		return err
+	}
+	currentDb = p.database()
+	readOnly = *roFlag || p.ReadOnly
 
 	sizeX, sizeY := g.Size()
 	treeSize = int(math.Floor(float64(sizeX) * 0.2))
-	treeView, err := g.SetView(treeView, 0, 0, treeSize, sizeY-4)
+	g.DeleteView(subValueView)
+	if err := renderTabs(g); err != nil {
+		return err
+	}
+	top := viewTop()
+	tv, err := g.SetView(treeView, 0, top, treeSize, sizeY-4)
 	if err != nil && err != gocui.ErrUnknownView {
-		panic(err)
+		return err
 	}
-	treeView.Wrap = true
-	treeView.Highlight = true
-	treeView.SelBgColor = gocui.ColorWhite
-	treeView.SelFgColor = gocui.ColorBlack
-	renderTree(g, treeView)
-	valueView, err := g.SetView(valueView, treeSize+1, 0, sizeX-1, sizeY-4)
+	tv.Wrap = false
+	tv.Highlight = true
+	tv.SelBgColor = gocui.ColorWhite
+	tv.SelFgColor = gocui.ColorBlack
+	renderTree(g, tv)
+	vv, err := g.SetView(valueView, treeSize+1, top, sizeX-1, sizeY-4)
 	if err != nil && err != gocui.ErrUnknownView {
-		panic(err)
+		return err
 	}
-	valueView.Wrap = true
-	valueView.SelBgColor = gocui.ColorWhite
-	valueView.SelFgColor = gocui.ColorBlack
-	renderValue(g, valueView)
+	vv.Wrap = true
+	vv.SelBgColor = gocui.ColorWhite
+	vv.SelFgColor = gocui.ColorBlack
+	renderValue(g, vv)
 
-	statusView, err := g.SetView(statusView, 0, sizeY-3, sizeX-1, sizeY-1)
+	sv, err := g.SetView(statusView, 0, sizeY-3, sizeX-1, sizeY-1)
 	if err != nil && err != gocui.ErrUnknownView {
-		panic(err)
+		return err
 	}
-	go func() {
-		tm := time.NewTicker(time.Second)
-		for range tm.C {
-			g.Update(func(g *gocui.Gui) error {
-				return renderStatus(statusView)
-			})
-		}
-	}()
+	renderStatus(sv)
+	loadStatus(g)
 
-	g.SetCurrentView(currentView)
-
-	if err := g.MainLoop(); err != nil && err != gocui.ErrQuit {
-		panic(err)
-	}
+	_, err = g.SetCurrentView(currentView)
+	return err
 }
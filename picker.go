@@ -0,0 +1,110 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jroimartin/gocui"
+)
+
+const profilesView = "profiles"
+
+var (
+	// profileNames holds the names of the profiles in the picker
+	profileNames []string
+	// pickState tells the profile being connected to or why connecting
+	// failed, it is shown below the profiles
+	pickState string
+	picking   bool
+)
+
+// showProfiles shows the profiles of the config file to pick the one to
+// connect to
+func showProfiles(g *gocui.Gui) error {
+	profileNames = profileNames[:0]
+	for name := range cfg.Profiles {
+		profileNames = append(profileNames, name)
+	}
+	sort.Strings(profileNames)
+	if err := layoutProfiles(g); err != nil {
+		return err
+	}
+	_, err := g.SetCurrentView(profilesView)
+	return err
+}
+
+// layoutProfiles places the picker in the middle of the screen
+func layoutProfiles(g *gocui.Gui) error {
+	sizeX, sizeY := g.Size()
+	w, h := 50, len(profileNames)+3
+	v, err := g.SetView(profilesView, (sizeX-w)/2, (sizeY-h)/2, (sizeX+w)/2, (sizeY+h)/2)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	if _, err := g.SetViewOnTop(profilesView); err != nil {
+		return err
+	}
+	v.Title = "connect to (enter connects)"
+	v.Wrap = true
+	v.Highlight = true
+	v.SelBgColor = gocui.ColorWhite
+	v.SelFgColor = gocui.ColorBlack
+	v.Clear()
+	for _, name := range profileNames {
+		p := cfg.Profiles[name]
+		info := p.kvType()
+		if p.ReadOnly {
+			info += ", read-only"
+		}
+		fmt.Fprintf(v, " %s  %s(%s)%s\n", name, dimStart, info, dimEnd)
+	}
+	if pickState != "" {
+		fmt.Fprintf(v, "\n %s", pickState)
+	}
+	return nil
+}
+
+// closeProfiles closes the picker, when a tab is open
+func closeProfiles(g *gocui.Gui, v *gocui.View) error {
+	if kvstore == nil {
+		return nil
+	}
+	pickState = ""
+	if err := g.DeleteView(profilesView); err != nil {
+		return err
+	}
+	_, err := g.SetCurrentView(currentView)
+	return err
+}
+
+// pickProfile connects to the profile under the cursor
+func pickProfile(g *gocui.Gui, v *gocui.View) error {
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	if picking || cy+oy >= len(profileNames) {
+		return nil
+	}
+	name := profileNames[cy+oy]
+	p := cfg.Profiles[name]
+	pickState, picking = "connecting to "+name, true
+	go func() {
+		store, err := connect(p)
+		g.Update(func(g *gocui.Gui) error {
+			picking = false
+			if err != nil {
+				pickState = fmt.Sprintf("%s: %v", name, err)
+				return nil
+			}
+			pickState = ""
+			if err := g.DeleteView(profilesView); err != nil {
+				return err
+			}
+			return open(g, name, p, store)
+		})
+	}()
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jroimartin/gocui"
+)
+
+const promptView = "prompt"
+
+// promptDone is called with the input when the prompt is confirmed
+var promptDone func(g *gocui.Gui, input string) error
+
+// prompt asks for a line of input in a view on top of the status view.
+// Enter confirms the input and calls done, escape cancels the prompt.
+func prompt(g *gocui.Gui, title, value string, done func(g *gocui.Gui, input string) error) error {
+	sizeX, sizeY := g.Size()
+	v, err := g.SetView(promptView, 0, sizeY-3, sizeX-1, sizeY-1)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	v.Title = title
+	v.Editable = true
+	v.Wrap = false
+	v.Clear()
+	fmt.Fprint(v, value)
+	v.SetOrigin(0, 0)
+	v.SetCursor(len([]rune(value)), 0)
+	promptDone = done
+	_, err = g.SetCurrentView(promptView)
+	return err
+}
+
+// closePrompt removes the prompt and gives the focus back to currentView
+func closePrompt(g *gocui.Gui) error {
+	promptDone = nil
+	if err := g.DeleteView(promptView); err != nil {
+		return err
+	}
+	_, err := g.SetCurrentView(currentView)
+	return err
+}
+
+func promptConfirm(g *gocui.Gui, v *gocui.View) error {
+	done := promptDone
+	input := strings.TrimSuffix(v.Buffer(), "\n")
+	if err := closePrompt(g); err != nil {
+		return err
+	}
+	if done == nil {
+		return nil
+	}
+	return done(g, input)
+}
+
+func promptCancel(g *gocui.Gui, v *gocui.View) error {
+	return closePrompt(g)
+}
+
+const confirmView = "confirm"
+
+var (
+	// confirmYes is called when the question is answered with yes
+	confirmYes func(g *gocui.Gui) error
+	// confirmReturn is the view getting the focus back after the question
+	confirmReturn string
+)
+
+// confirm asks a yes/no question in a view in the middle of the screen and
+// calls yes when it is answered with 'y', 'n' or escape closes the view.
+func confirm(g *gocui.Gui, question string, yes func(g *gocui.Gui) error) error {
+	sizeX, sizeY := g.Size()
+	w := len([]rune(question)) + 8
+	v, err := g.SetView(confirmView, (sizeX-w)/2, sizeY/2-1, (sizeX+w)/2, sizeY/2+1)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	v.Clear()
+	fmt.Fprintf(v, " %s [y/N]", question)
+	confirmYes = yes
+	confirmReturn = currentView
+	if cv := g.CurrentView(); cv != nil {
+		confirmReturn = cv.Name()
+	}
+	_, err = g.SetCurrentView(confirmView)
+	return err
+}
+
+// closeConfirm removes the question and gives the focus back
+func closeConfirm(g *gocui.Gui) error {
+	confirmYes = nil
+	if err := g.DeleteView(confirmView); err != nil {
+		return err
+	}
+	_, err := g.SetCurrentView(confirmReturn)
+	return err
+}
+
+func confirmAccept(g *gocui.Gui, v *gocui.View) error {
+	yes := confirmYes
+	if err := closeConfirm(g); err != nil {
+		return err
+	}
+	if yes == nil {
+		return nil
+	}
+	return yes(g)
+}
+
+func confirmReject(g *gocui.Gui, v *gocui.View) error {
+	return closeConfirm(g)
+}
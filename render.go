@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"strconv"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/jroimartin/gocui"
+	"github.com/rikvdh/kvui/kv"
 	"github.com/rikvdh/kvui/kv/types"
 )
 
@@ -21,8 +23,7 @@ const (
 	statusView   = "status"
 	subValueView = "subvalue"
 
-	keyPrefix = "  - "
-	dbPrefix  = " db:"
+	loading = "loading…"
 )
 
 var (
@@ -30,139 +31,338 @@ var (
 	currentDb      = 0
 	currentKey     = ""
 	currentKeyType = types.KVTypeInvalid
+	// currentValue holds the value of currentKey, it is nil while loading
+	currentValue *keyValue
+	currentField = ""
+	// subValue holds the value of currentField, it is nil while loading
+	subValue *fieldValue
 )
 
-func renderTree(g *gocui.Gui, v *gocui.View) error {
-	v.Clear()
-	databases, err := kvstore.Databases()
+// keyValue is the value of a key as fetched from the KV-store
+type keyValue struct {
+	key  string
+	t    types.KVType
+	data []byte
+	// shown is data decoded for display
+	shown decoded
+	// elements holds the fetched elements of lists, maps, sets and sorted
+	// sets, the members of sorted sets are ordered by score unless
+	// memberOrder is set
+	elements
+	// entries holds the fetched entries of a stream, entriesDone is set
+	// when there are no more to fetch
+	entries        []kv.XMessage
+	entriesDone    bool
+	entriesLoading bool
+	groups         []streamGroup
+	// ttl is the time left before key expires, negative without expiration
+	ttl    time.Duration
+	hasTTL bool
+}
+
+// fetchValue fetches the type and value of key, memberOrder sorts sorted
+// sets by member
+func fetchValue(ctx context.Context, store kv.KV, key string, dec decoding, memberOrder bool) (*keyValue, error) {
+	t, err := store.Type(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	val := &keyValue{key: key, t: t}
+	val.memberOrder = memberOrder
+	switch t {
+	case types.KVTypeString:
+		val.data, err = store.Get(ctx, key)
+		val.shown = decodeValue(dec, val.data)
+	case types.KVTypeMap, types.KVTypeList, types.KVTypeSet, types.KVTypeSortedSet:
+		err = fetchFirst(ctx, store, val)
+	case types.KVTypeStream:
+		err = fetchStream(ctx, store, key, val)
+	}
 	if err != nil {
-		fmt.Fprintln(v, err)
+		return nil, err
+	}
+	if ttl, err := store.TTL(ctx, key); err == nil {
+		val.ttl, val.hasTTL = ttl, true
+	}
+	return val, nil
+}
+
+// loadValue fetches the value of currentKey, the value view shows a
+// placeholder until it is there
+func loadValue(g *gocui.Gui) {
+	key := currentKey
+	prev := currentValue
+	currentValue = nil
+	currentField = ""
+	if key == "" && currentKeyType != types.KVTypeInvalid {
+		// nothing selected, drop the layout of the last value
+		currentKeyType = types.KVTypeInvalid
+		renderLayout(g)
 	}
-	for i := 0; i < databases; i++ {
-		if i == currentDb {
-			fmt.Fprintf(v, "-%s%d\n", dbPrefix, i)
-			keys, err := kvstore.Keys("*")
+	if key != "" {
+		dec, memberOrder := decodingOf(key), sortByMember
+		kvfetch.fetch("value", func(ctx context.Context, store kv.KV) (interface{}, error) {
+			return fetchValue(ctx, store, key, dec, memberOrder)
+		}, func(g *gocui.Gui, res interface{}, err error) error {
+			if key != currentKey {
+				return nil
+			}
 			if err != nil {
-				return err
+				showError(g, err)
+				return nil
 			}
-			for _, k := range keys {
-				fmt.Fprintf(v, "%s%s\n", keyPrefix, k)
+			currentValue = res.(*keyValue)
+			if currentValue.shown.err != nil {
+				showError(g, currentValue.shown.err)
 			}
-		} else {
-			fmt.Fprintf(v, "+%s%d\n", dbPrefix, i)
+			if prev != nil && prev.key == key {
+				// reloaded, keep the selected element
+				currentValue.top, currentValue.sel = prev.top, prev.sel
+			}
+			if currentValue.hasTTL {
+				setExpiry(key, currentValue.ttl)
+				redrawView(g, treeView)
+			}
+			if currentKeyType != currentValue.t {
+				currentKeyType = currentValue.t
+				renderLayout(g)
+			}
+			if currentValue.t == types.KVTypeStream {
+				redrawView(g, subValueView)
+			}
+			return redrawView(g, valueView)
+		})
+	}
+	redrawView(g, valueView)
+}
+
+func renderValue(g *gocui.Gui, v *gocui.View) error {
+	v.Clear()
+	shown := shownElements
+	shownElements = ""
+	defer func() {
+		if shownElements != shown {
+			redrawView(g, statusView)
 		}
+	}()
+	v.Title = printable(currentKey)
+	if ttl := formatTTL(currentKey); ttl != "" {
+		v.Title += " ttl " + ttl
 	}
-	_, pos := v.Cursor()
-	l, err := v.Line(pos)
-	if err != nil {
-		fmt.Fprintf(v, "error: %v", err)
+	if currentKey == "" {
+		fmt.Fprintln(v, time.Now().Format(time.Stamp), currentView)
 		return nil
 	}
-	if strings.HasPrefix(l, keyPrefix) {
-		currentKey = l[len(keyPrefix):]
-	} else if strings.HasPrefix(l, "-"+dbPrefix) || strings.HasPrefix(l, "+"+dbPrefix) {
-		currentKey = ""
+	if currentValue == nil {
+		fmt.Fprintln(v, loading)
+		return nil
 	}
-
-	vv, _ := g.View(valueView)
-	if vv != nil {
-		if err := renderValue(g, vv); err != nil {
-			sv, _ := g.View(statusView)
-			renderStatus(sv, err)
+	switch currentValue.t {
+	case types.KVTypeString:
+		shown := currentValue.shown
+		if shown.chain != "" {
+			v.Title += " " + shown.chain
+		}
+		switch {
+		case showsJSON():
+			v.Title += " json"
+			jsonLines = renderJSON(v, shown.json, 0, false, nil)
+		case shown.json != nil && !showsHex(currentValue.key, shown):
+			v.Title += " raw"
+			fallthrough
+		default:
+			if mode := renderDecoded(v, currentValue.key, shown); mode != "" {
+				v.Title += " " + mode
+			}
 		}
+	case types.KVTypeMap, types.KVTypeList, types.KVTypeSet, types.KVTypeSortedSet:
+		renderElements(g, v, currentValue)
+	case types.KVTypeStream:
+		renderStream(g, v, currentValue)
 	}
 	return nil
 }
 
-func dbSelect(g *gocui.Gui, v *gocui.View) error {
-	if v.Name() == treeView {
-		_, pos := v.Cursor()
-		l, err := v.Line(pos)
-		if err != nil {
-			fmt.Fprintf(v, "error: %v", err)
-			return nil
-		}
-		if strings.HasPrefix(l, "+"+dbPrefix) {
-			currentDb, err = strconv.Atoi(l[len("+"+dbPrefix):])
-			kvstore.Database(currentDb)
-			renderTree(g, v)
-		} else if strings.HasPrefix(l, "-"+dbPrefix) {
+// sortByMember sorts sorted sets in the value view by member instead of score
+var sortByMember = false
+
+// byMember sorts members of a sorted set by member
+type byMember []kv.Z
+
+func (b byMember) Len() int           { return len(b) }
+func (b byMember) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byMember) Less(i, j int) bool { return b[i].Member < b[j].Member }
+
+// renderSortedSet renders members in two columns, member and score. The
+// column members are sorted by is marked, by member when memberOrder is set.
+func renderSortedSet(v *gocui.View, members []kv.Z, memberOrder bool) {
+	member, score := "member", "score"
+	if memberOrder {
+		member += " ▾"
+	} else {
+		score += " ▾"
+	}
+	maxX, _ := v.Size()
+	w := len([]rune(member))
+	for _, z := range members {
+		if n := len([]rune(printable(z.Member))); n > w {
+			w = n
 		}
 	}
+	if w > maxX/2 {
+		w = maxX / 2
+	}
+	fmt.Fprintf(v, "%-*s | %s\n", w, member, score)
+	for _, z := range members {
+		fmt.Fprintf(v, "%-*s | %s\n", w, printable(z.Member), strconv.FormatFloat(z.Score, 'g', -1, 64))
+	}
+}
+
+// toggleSort switches the order of sorted sets between score and member,
+// and of streams between oldest and newest first
+func toggleSort(g *gocui.Gui, v *gocui.View) error {
+	if currentValue != nil && currentValue.t == types.KVTypeStream {
+		streamNewestFirst = !streamNewestFirst
+		loadValue(g)
+		return nil
+	}
+	if currentValue != nil && currentValue.t == types.KVTypeSortedSet &&
+		!sortByMember && currentValue.total > maxMemberOrder {
+		showError(g, fmt.Errorf("sorted sets of more than %d members can't be sorted by member", maxMemberOrder))
+		return nil
+	}
+	sortByMember = !sortByMember
+	if currentValue != nil && currentValue.t == types.KVTypeSortedSet {
+		// the members are fetched again in the new order
+		loadValue(g)
+	}
 	return nil
 }
 
-func renderValue(g *gocui.Gui, v *gocui.View) error {
-	v.Clear()
-	if currentKey != "" {
-		t, err := kvstore.Type(currentKey)
+// fieldValue is the value of a map field as fetched from the KV-store
+type fieldValue struct {
+	data  []byte
+	shown decoded
+}
+
+// loadSubValue fetches the value of currentField in the map currentKey
+func loadSubValue(g *gocui.Gui) {
+	key, field := currentKey, currentField
+	subValue = nil
+	dec := decodingOf(key)
+	kvfetch.fetch("subvalue", func(ctx context.Context, store kv.KV) (interface{}, error) {
+		val, err := store.HGet(ctx, key, field)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if currentKeyType != t {
-			currentKeyType = t
-			renderLayout(g)
+		return &fieldValue{data: val, shown: decodeValue(dec, val)}, nil
+	}, func(g *gocui.Gui, res interface{}, err error) error {
+		if key != currentKey || field != currentField {
+			return nil
 		}
-		switch t {
-		case types.KVTypeString:
-			s, err := kvstore.Get(currentKey)
-			if err != nil {
-				return err
-			}
-			fmt.Fprintf(v, s)
-		case types.KVTypeMap:
-			s, err := kvstore.HKeys(currentKey)
-			if err != nil {
-				return err
-			}
-			for _, i := range s {
-				fmt.Fprintf(v, "- %v\n", i)
-			}
-			_, p := v.Cursor()
-			str, _ := v.Line(p)
-			if len(str) >= 3 {
-				renderSubValue(g, str[2:])
-			}
-		case types.KVTypeList:
-			s, err := kvstore.LGet(currentKey)
-			if err != nil {
-				return err
-			}
-			for _, i := range s {
-				fmt.Fprintf(v, "- %v\n", i)
-			}
+		if err != nil {
+			showError(g, err)
+			return nil
 		}
-	} else {
-		fmt.Fprintln(v, time.Now().Format(time.Stamp), currentView)
-	}
-	return nil
+		subValue = res.(*fieldValue)
+		if subValue.shown.err != nil {
+			showError(g, subValue.shown.err)
+		}
+		return redrawView(g, subValueView)
+	})
+	redrawView(g, subValueView)
 }
 
-func renderSubValue(g *gocui.Gui, field string) error {
-	v, err := g.View(subValueView)
-	if err != nil {
-		return err
-	}
+func renderSubValue(g *gocui.Gui, v *gocui.View) error {
 	v.Clear()
-	val, err := kvstore.HGet(currentKey, field)
-	if err != nil {
-		return err
+	if currentValue != nil && currentValue.t == types.KVTypeStream {
+		renderGroups(v, currentValue)
+		return nil
+	}
+	if subValue == nil {
+		fmt.Fprintln(v, loading)
+		return nil
+	}
+	shown := subValue.shown
+	v.Title = shown.chain
+	if shown.json != nil && !rawValues && !showsHex(currentValue.key, shown) {
+		renderJSON(v, shown.json, 0, false, nil)
+		return nil
+	}
+	if mode := renderDecoded(v, currentValue.key, shown); mode != "" {
+		v.Title = strings.TrimSpace(v.Title + " " + mode)
 	}
-	fmt.Fprintf(v, val)
 	return nil
 }
 
-var lastErr error
+var (
+	lastErr error
+	// shownElements tells which elements the value view shows
+	shownElements string
+	// conState is the last fetched connection state, nil until fetched
+	conState *connection
+)
+
+// connection is the connection state of the KV-store
+type connection struct {
+	connected bool
+	err       error
+	// node describes the node in use of KV-stores with several nodes
+	node string
+}
+
+// loadStatus fetches the connection state of the KV-store
+func loadStatus(g *gocui.Gui) {
+	kvfetch.fetch("status", func(ctx context.Context, store kv.KV) (interface{}, error) {
+		con, err := store.Connected(ctx)
+		state := &connection{connected: con, err: err}
+		if n, ok := store.(kv.Noder); ok {
+			state.node = n.Node()
+		}
+		return state, nil
+	}, func(g *gocui.Gui, res interface{}, err error) error {
+		conState = res.(*connection)
+		if conState.connected && dbNames != nil && len(dbNames) == 0 && !dbLoading {
+			// loading the databases failed, try again now the
+			// connection is back
+			dbNames = nil
+			if err := redrawView(g, treeView); err != nil {
+				return err
+			}
+		}
+		return redrawView(g, statusView)
+	})
+}
 
 func renderStatus(v *gocui.View, err ...error) error {
 	v.Clear()
-	con, conerr := kvstore.Connected()
-	if con {
+	switch {
+	case conState == nil:
+		v.FgColor = gocui.ColorYellow
+		fmt.Fprintf(v, " connecting")
+	case conState.connected:
 		v.FgColor = gocui.ColorGreen
 		fmt.Fprintf(v, " connected")
-	} else {
+	case reconnecting(conState.err) != nil:
+		re := reconnecting(conState.err)
+		v.FgColor = gocui.ColorYellow
+		if in := re.In(); in > 0 {
+			fmt.Fprintf(v, " reconnecting in %s (%v)", in, re.Err)
+		} else {
+			fmt.Fprintf(v, " reconnecting (%v)", re.Err)
+		}
+	default:
 		v.FgColor = gocui.ColorRed
-		fmt.Fprintf(v, " disconnected (%v)", conerr)
+		fmt.Fprintf(v, " disconnected (%v)", conState.err)
+	}
+	if conState != nil && conState.node != "" {
+		fmt.Fprintf(v, " to %s", conState.node)
+	}
+	if readOnly {
+		fmt.Fprint(v, " (read-only)")
+	}
+	if shownElements != "" {
+		fmt.Fprintf(v, "  %s%s%s", dimStart, shownElements, dimEnd)
 	}
 
 	if len(err) >= 1 {
@@ -174,35 +374,78 @@ func renderStatus(v *gocui.View, err ...error) error {
 	return nil
 }
 
+// reconnecting returns err when the KV-store reconnects automatically
+func reconnecting(err error) *kv.ReconnectError {
+	re, _ := err.(*kv.ReconnectError)
+	return re
+}
+
+// showError shows err in the status view
+func showError(g *gocui.Gui, err error) {
+	if sv, _ := g.View(statusView); sv != nil {
+		renderStatus(sv, err)
+	}
+}
+
 func renderLayout(g *gocui.Gui) error {
+	if kvstore == nil {
+		return layoutProfiles(g)
+	}
 	sizeX, sizeY := g.Size()
 	treeSize = int(math.Floor(float64(sizeX) * 0.2))
 
-	_, err := g.SetView(treeView, 0, 0, treeSize, sizeY-4)
+	if err := renderTabs(g); err != nil {
+		return err
+	}
+	top := viewTop()
+	_, err := g.SetView(treeView, 0, top, treeSize, sizeY-4)
 	if err != nil {
 		return err
 	}
-	if currentKeyType == types.KVTypeMap {
-		vView, err := g.SetView(valueView, treeSize+1, 0, treeSize*2, sizeY-4)
+	if currentKeyType == types.KVTypeMap || currentKeyType == types.KVTypeStream {
+		vView, err := g.SetView(valueView, treeSize+1, top, treeSize*2, sizeY-4)
 		if err != nil {
 			return err
 		}
 		vView.Highlight = true
-		svView, err := g.SetView(subValueView, treeSize*2+1, 0, sizeX-1, sizeY-4)
+		svView, err := g.SetView(subValueView, treeSize*2+1, top, sizeX-1, sizeY-4)
 		svView.Wrap = true
-		if err != nil {
+		if err != nil && err != gocui.ErrUnknownView {
 			return err
 		}
+		if err == gocui.ErrUnknownView {
+			renderSubValue(g, svView)
+		}
 	} else {
-		vView, err := g.SetView(valueView, treeSize+1, 0, sizeX-1, sizeY-4)
+		vView, err := g.SetView(valueView, treeSize+1, top, sizeX-1, sizeY-4)
 		if err != nil {
 			return err
 		}
-		vView.Highlight = false
+		vView.Highlight = paged(currentKeyType) || showsJSON()
+		// highlighted lines must not wrap, they are selected by line
+		vView.Wrap = !vView.Highlight
 		g.DeleteView(subValueView)
 	}
 	_, err = g.SetView(statusView, 0, sizeY-3, sizeX-1, sizeY-1)
-	return err
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{editView, createView} {
+		if _, err := g.View(name); err == nil {
+			if _, err := g.SetView(name, treeSize+1, top, sizeX-1, sizeY-4); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := g.View(promptView); err == nil {
+		if _, err = g.SetView(promptView, 0, sizeY-3, sizeX-1, sizeY-1); err != nil {
+			return err
+		}
+	}
+	if _, err := g.View(profilesView); err == nil {
+		return layoutProfiles(g)
+	}
+	return nil
 }
 
 func switchViewRight(g *gocui.Gui, v *gocui.View) error {
@@ -225,20 +468,26 @@ func switchViewLeft(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
-func redraw(g *gocui.Gui, v *gocui.View) error {
-	nv, err := g.View(currentView)
+// redrawView renders the view with the given name from the current state
+func redrawView(g *gocui.Gui, name string) error {
+	v, err := g.View(name)
 	if err != nil {
-		return err
+		// the view is not (yet) part of the layout
+		return nil
 	}
-	switch currentView {
+	switch name {
 	case treeView:
-		renderTree(g, nv)
+		return renderTree(g, v)
 	case valueView:
-		err := renderValue(g, nv)
-		if err != nil {
-			sv, _ := g.View(statusView)
-			renderStatus(sv, err)
-		}
+		return renderValue(g, v)
+	case subValueView:
+		return renderSubValue(g, v)
+	case statusView:
+		return renderStatus(v)
 	}
 	return nil
 }
+
+func redraw(g *gocui.Gui, v *gocui.View) error {
+	return redrawView(g, currentView)
+}
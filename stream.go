@@ -0,0 +1,151 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jroimartin/gocui"
+	"github.com/rikvdh/kvui/kv"
+)
+
+// streamNewestFirst shows the entries of streams newest first
+var streamNewestFirst = false
+
+// streamGroup is a consumer group of a stream with its consumers
+type streamGroup struct {
+	kv.XInfoGroup
+	consumers []kv.XInfoConsumer
+}
+
+// streamPage is a page of entries of a stream
+type streamPage struct {
+	entries []kv.XMessage
+	// done is true when there are no entries after this page
+	done bool
+}
+
+// fetchEntries fetches the page of entries after the last one in entries
+func fetchEntries(ctx context.Context, store kv.KV, key string, entries []kv.XMessage) (*streamPage, error) {
+	streams, ok := store.(kv.Streamer)
+	if !ok {
+		return nil, kv.ErrNotSupported
+	}
+	var (
+		msgs []kv.XMessage
+		err  error
+	)
+	if streamNewestFirst {
+		end := "+"
+		if len(entries) > 0 {
+			if end, err = kv.PrevStreamID(entries[len(entries)-1].ID); err != nil || end == "" {
+				return &streamPage{done: true}, err
+			}
+		}
+		msgs, err = streams.XRevRange(ctx, key, end, "-", *pageSize)
+	} else {
+		start := "-"
+		if len(entries) > 0 {
+			if start, err = kv.NextStreamID(entries[len(entries)-1].ID); err != nil {
+				return nil, err
+			}
+		}
+		msgs, err = streams.XRange(ctx, key, start, "+", *pageSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &streamPage{entries: msgs, done: len(msgs) < *pageSize}, nil
+}
+
+// fetchStream fetches the first page of entries and the consumer groups
+// of the stream key into val
+func fetchStream(ctx context.Context, store kv.KV, key string, val *keyValue) error {
+	page, err := fetchEntries(ctx, store, key, nil)
+	if err != nil {
+		return err
+	}
+	val.entries, val.entriesDone = page.entries, page.done
+
+	// fetchEntries fails for KV-stores without streams
+	streams := store.(kv.Streamer)
+	groups, err := streams.XInfoGroups(ctx, key)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		consumers, err := streams.XInfoConsumers(ctx, key, g.Name)
+		if err != nil {
+			return err
+		}
+		val.groups = append(val.groups, streamGroup{XInfoGroup: g, consumers: consumers})
+	}
+	return nil
+}
+
+// loadEntries fetches the next page of entries of the stream in currentValue
+func loadEntries(g *gocui.Gui) {
+	val := currentValue
+	if val.entriesLoading {
+		return
+	}
+	val.entriesLoading = true
+	entries := val.entries
+	kvfetch.fetch("entries", func(ctx context.Context, store kv.KV) (interface{}, error) {
+		return fetchEntries(ctx, store, val.key, entries)
+	}, func(g *gocui.Gui, res interface{}, err error) error {
+		val.entriesLoading = false
+		if err != nil {
+			showError(g, err)
+			return nil
+		}
+		page := res.(*streamPage)
+		val.entries = append(val.entries, page.entries...)
+		val.entriesDone = page.done
+		return redrawView(g, valueView)
+	})
+}
+
+// renderStream renders the entries of a stream by ID with their fields
+// and values below them
+func renderStream(g *gocui.Gui, v *gocui.View, val *keyValue) {
+	lines := 0
+	for _, e := range val.entries {
+		fmt.Fprintln(v, printable(e.ID))
+		lines++
+		for i := 0; i+1 < len(e.Values); i += 2 {
+			fmt.Fprintf(v, "  %s: %s\n", printable(e.Values[i]), printable(e.Values[i+1]))
+			lines++
+		}
+	}
+	switch {
+	case val.entriesLoading:
+		fmt.Fprintln(v, loading)
+	case !val.entriesDone:
+		fmt.Fprintln(v, moreKeys)
+		_, p := v.Cursor()
+		_, oy := v.Origin()
+		if p+oy >= lines {
+			// the cursor reached the end of the fetched entries
+			loadEntries(g)
+		}
+	}
+}
+
+// renderGroups renders the consumer groups of a stream with their pending
+// entries and consumers
+func renderGroups(v *gocui.View, val *keyValue) {
+	if len(val.groups) == 0 {
+		fmt.Fprintln(v, "no consumer groups")
+		return
+	}
+	for _, grp := range val.groups {
+		fmt.Fprintf(v, "%s\n  pending %d, last delivered %s\n", printable(grp.Name), grp.Pending, grp.LastDeliveredID)
+		for _, c := range grp.consumers {
+			fmt.Fprintf(v, "  - %s pending %d, idle %s\n", printable(c.Name), c.Pending, c.Idle)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jroimartin/gocui"
+	"github.com/rikvdh/kvui/decode"
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/types"
+)
+
+const (
+	tabsView = "tabs"
+
+	activeTabStart = "\x1b[7m"
+	activeTabEnd   = "\x1b[0m"
+)
+
+// tab is a connection opened in a tab with the state of its views. The
+// state of the active tab lives in the globals the views are rendered
+// from, it is stored in the tab when another tab is shown.
+type tab struct {
+	name string
+
+	store    kv.KV
+	fetch    *fetcher
+	readOnly bool
+	conState *connection
+	lastErr  error
+
+	decoderRules  []decoderRule
+	decoderChains []decode.Chain
+	extraDecoders []decode.Decoder
+	decodeMode    map[string]int
+	hexToggled    map[string]bool
+
+	view     string
+	db       int
+	key      string
+	keyType  types.KVType
+	value    *keyValue
+	field    string
+	subValue *fieldValue
+	elements string
+	json     []*jsonNode
+	undo     []*deletion
+
+	treeLines   []treeLine
+	dbNames     []string
+	dbLoading   bool
+	treeRoot    *nsNode
+	treeIter    *kv.KeyIterator
+	treeLoading bool
+	expanded    map[string]bool
+	expiries    map[string]time.Time
+	filter      *keyFilter
+
+	// cursors holds the cursor and origin of the views
+	cursors map[string][4]int
+}
+
+var (
+	tabs      []*tab
+	activeTab = -1
+	// gPressed is set when g was pressed, the next key is looked up in
+	// gBindings then, like gt and gT in vim
+	gPressed bool
+)
+
+// gBindings holds the keys bound after pressing g
+var gBindings = map[rune]func(*gocui.Gui, *gocui.View) error{
+	't': nextTab,
+	'T': prevTab,
+}
+
+// newTab returns a tab showing store, with the state of a view that
+// shows nothing yet
+func newTab(g *gocui.Gui, name string, store kv.KV) *tab {
+	return &tab{
+		name:       name,
+		store:      store,
+		fetch:      newFetcher(g, store),
+		decodeMode: make(map[string]int),
+		hexToggled: make(map[string]bool),
+		view:       treeView,
+		keyType:    types.KVTypeInvalid,
+		treeRoot:   newNamespace("", ""),
+		expanded:   make(map[string]bool),
+		expiries:   make(map[string]time.Time),
+		// the views start at the top
+		cursors: map[string][4]int{treeView: {}, valueView: {}, subValueView: {}},
+	}
+}
+
+// save stores the state of the views in t
+func (t *tab) save(g *gocui.Gui) {
+	t.store, t.fetch, t.readOnly, t.conState, t.lastErr = kvstore, kvfetch, readOnly, conState, lastErr
+	t.decoderRules, t.decoderChains, t.extraDecoders = decoderRules, decoderChains, extraDecoders
+	t.decodeMode, t.hexToggled = decodeMode, hexToggled
+	t.view, t.db, t.key, t.keyType = currentView, currentDb, currentKey, currentKeyType
+	t.value, t.field, t.subValue = currentValue, currentField, subValue
+	t.elements, t.json, t.undo = shownElements, jsonLines, undoBuffer
+	t.treeLines, t.dbNames, t.dbLoading = treeLines, dbNames, dbLoading
+	t.treeRoot, t.treeIter, t.treeLoading = treeRoot, treeIter, treeLoading
+	t.expanded, t.expiries, t.filter = expanded, expiries, treeFilter
+	for _, name := range []string{treeView, valueView, subValueView} {
+		if v, err := g.View(name); err == nil {
+			cx, cy := v.Cursor()
+			ox, oy := v.Origin()
+			t.cursors[name] = [4]int{cx, cy, ox, oy}
+		}
+	}
+}
+
+// restore makes the state of the views the one stored in t
+func (t *tab) restore(g *gocui.Gui) {
+	kvstore, kvfetch, readOnly, conState, lastErr = t.store, t.fetch, t.readOnly, t.conState, t.lastErr
+	decoderRules, decoderChains, extraDecoders = t.decoderRules, t.decoderChains, t.extraDecoders
+	decodeMode, hexToggled = t.decodeMode, t.hexToggled
+	currentView, currentDb, currentKey, currentKeyType = t.view, t.db, t.key, t.keyType
+	currentValue, currentField, subValue = t.value, t.field, t.subValue
+	shownElements, jsonLines, undoBuffer = t.elements, t.json, t.undo
+	treeLines, dbNames, dbLoading = t.treeLines, t.dbNames, t.dbLoading
+	treeRoot, treeIter, treeLoading = t.treeRoot, t.treeIter, t.treeLoading
+	expanded, expiries, treeFilter = t.expanded, t.expiries, t.filter
+}
+
+// place puts the cursors of the views where they were in t
+func (t *tab) place(g *gocui.Gui) {
+	for name, c := range t.cursors {
+		if v, err := g.View(name); err == nil {
+			v.SetOrigin(c[2], c[3])
+			v.SetCursor(c[0], c[1])
+		}
+	}
+}
+
+// addTab shows store in a new tab
+func addTab(g *gocui.Gui, name string, store kv.KV) {
+	if activeTab >= 0 {
+		tabs[activeTab].save(g)
+	}
+	t := newTab(g, name, store)
+	tabs = append(tabs, t)
+	activeTab = len(tabs) - 1
+	t.restore(g)
+	t.place(g)
+}
+
+// showTab switches to tab i and shows its views
+func showTab(g *gocui.Gui, i int) error {
+	if i == activeTab || i < 0 || i >= len(tabs) {
+		return nil
+	}
+	if activeTab >= 0 {
+		tabs[activeTab].save(g)
+	}
+	activeTab = i
+	tabs[i].restore(g)
+	if currentKeyType != types.KVTypeMap && currentKeyType != types.KVTypeStream {
+		g.DeleteView(subValueView)
+	}
+	if err := renderLayout(g); err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	tabs[i].place(g)
+	for _, name := range []string{treeView, valueView, subValueView, statusView} {
+		if err := redrawView(g, name); err != nil {
+			return err
+		}
+	}
+	// deliver what was fetched while the tab was not shown
+	if err := kvfetch.resume(g); err != nil {
+		return err
+	}
+	loadStatus(g)
+	_, err := g.SetCurrentView(currentView)
+	return err
+}
+
+func nextTab(g *gocui.Gui, v *gocui.View) error {
+	return showTab(g, (activeTab+1)%len(tabs))
+}
+
+func prevTab(g *gocui.Gui, v *gocui.View) error {
+	return showTab(g, (activeTab+len(tabs)-1)%len(tabs))
+}
+
+// openTab picks a profile to open in a new tab
+func openTab(g *gocui.Gui, v *gocui.View) error {
+	if len(cfg.Profiles) == 0 {
+		showError(g, fmt.Errorf("no profiles in %s", *cfgFile))
+		return nil
+	}
+	return showProfiles(g)
+}
+
+// closeTab closes the connection of the active tab, closing the last tab
+// quits
+func closeTab(g *gocui.Gui, v *gocui.View) error {
+	if len(tabs) == 1 {
+		return gocui.ErrQuit
+	}
+	t := tabs[activeTab]
+	t.fetch.close()
+	if c, ok := t.store.(io.Closer); ok {
+		c.Close()
+	}
+	tabs = append(tabs[:activeTab], tabs[activeTab+1:]...)
+	// show the tab that took its place, or the last one
+	i := activeTab
+	if i == len(tabs) {
+		i--
+	}
+	activeTab = -1
+	return showTab(g, i)
+}
+
+// pressG starts a key sequence like gt
+func pressG(g *gocui.Gui, v *gocui.View) error {
+	gPressed = true
+	return nil
+}
+
+// withG returns handler for key, which runs the binding of key in gBindings
+// instead when g was pressed before
+func withG(key interface{}, handler func(*gocui.Gui, *gocui.View) error) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		pressed := gPressed
+		gPressed = false
+		if r, ok := key.(rune); ok && pressed && gBindings[r] != nil {
+			return gBindings[r](g, v)
+		}
+		return handler(g, v)
+	}
+}
+
+// viewTop returns the top line of the views, below the tab bar when there
+// are several tabs
+func viewTop() int {
+	if len(tabs) > 1 {
+		return 1
+	}
+	return 0
+}
+
+// renderTabs lays out the tab bar, it is only shown with several tabs
+func renderTabs(g *gocui.Gui) error {
+	if len(tabs) < 2 {
+		g.DeleteView(tabsView)
+		return nil
+	}
+	sizeX, _ := g.Size()
+	v, err := g.SetView(tabsView, -1, -1, sizeX, 1)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	v.Frame = false
+	v.Clear()
+	for i, t := range tabs {
+		if i == activeTab {
+			fmt.Fprintf(v, "%s %d %s %s", activeTabStart, i+1, t.name, activeTabEnd)
+		} else {
+			fmt.Fprintf(v, " %d %s ", i+1, t.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jroimartin/gocui"
+	"github.com/rikvdh/kvui/kv"
+)
+
+const (
+	keyPrefix = "  - "
+	nsPrefix  = "  "
+	dbPrefix  = " db:"
+	// nodePrefix replaces dbPrefix for KV-stores whose databases are nodes
+	nodePrefix = " node:"
+	moreKeys   = "..."
+	indent     = "  "
+)
+
+// treeLine describes what is shown on a line of the tree view
+type treeLine struct {
+	db   int
+	key  string
+	ns   string
+	more bool
+}
+
+// nsNode is a namespace in the tree view. Keys are grouped in namespaces
+// by splitting them on the delimiter, so "user:1:name" ends up in the
+// namespace "user:" and its child namespace "user:1:".
+type nsNode struct {
+	name     string
+	path     string
+	children map[string]*nsNode
+	keys     []string
+	count    int
+}
+
+func newNamespace(name, path string) *nsNode {
+	return &nsNode{name: name, path: path, children: make(map[string]*nsNode)}
+}
+
+// insert adds key to the namespace or one of its child namespaces, it
+// reports false when key was already there
+func (n *nsNode) insert(key string) bool {
+	rest := key[len(n.path):]
+	i := -1
+	if *delimiter != "" {
+		i = strings.Index(rest, *delimiter)
+	}
+	if i < 0 {
+		// keep keys sorted, pages of keys arrive in no particular order
+		j := sort.SearchStrings(n.keys, key)
+		if j < len(n.keys) && n.keys[j] == key {
+			return false
+		}
+		n.keys = append(n.keys, "")
+		copy(n.keys[j+1:], n.keys[j:])
+		n.keys[j] = key
+		n.count++
+		return true
+	}
+	name := rest[:i]
+	c, ok := n.children[name]
+	if !ok {
+		c = newNamespace(name, n.path+name+*delimiter)
+		n.children[name] = c
+	}
+	if !c.insert(key) {
+		return false
+	}
+	n.count++
+	return true
+}
+
+// remove removes key from the namespace or one of its child namespaces,
+// child namespaces without keys are removed as well
+func (n *nsNode) remove(key string) bool {
+	rest := key[len(n.path):]
+	i := -1
+	if *delimiter != "" {
+		i = strings.Index(rest, *delimiter)
+	}
+	if i < 0 {
+		j := sort.SearchStrings(n.keys, key)
+		if j == len(n.keys) || n.keys[j] != key {
+			return false
+		}
+		n.keys = append(n.keys[:j], n.keys[j+1:]...)
+		n.count--
+		return true
+	}
+	c, ok := n.children[rest[:i]]
+	if !ok || !c.remove(key) {
+		return false
+	}
+	if c.count == 0 {
+		delete(n.children, c.name)
+	}
+	n.count--
+	return true
+}
+
+// childNames returns the names of the child namespaces of n, sorted
+func (n *nsNode) childNames() []string {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// walk appends the keys in n and its child namespaces to keys, in the
+// order they are rendered
+func (n *nsNode) walk(keys []string) []string {
+	for _, name := range n.childNames() {
+		keys = n.children[name].walk(keys)
+	}
+	return append(keys, n.keys...)
+}
+
+var (
+	// treeLines holds an entry for every line rendered in the tree view
+	treeLines []treeLine
+	// dbNames holds the names of the databases, nil until fetched
+	dbNames   []string
+	dbLoading bool
+	// treeRoot holds the keys of the current database fetched so far
+	treeRoot    = newNamespace("", "")
+	treeIter    *kv.KeyIterator
+	treeLoading bool
+	// expanded holds the paths of the expanded namespaces
+	expanded = make(map[string]bool)
+)
+
+// loadDatabases fetches the names of the databases
+func loadDatabases(g *gocui.Gui) {
+	dbLoading = true
+	kvfetch.fetch("databases", func(ctx context.Context, store kv.KV) (interface{}, error) {
+		databases, err := store.Databases(ctx)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, databases)
+		for i := range names {
+			name, err := store.DatabaseName(ctx, i)
+			if err != nil {
+				name = strconv.Itoa(i)
+			}
+			names[i] = name
+		}
+		return names, nil
+	}, func(g *gocui.Gui, res interface{}, err error) error {
+		dbLoading = false
+		if err != nil {
+			showError(g, err)
+			dbNames = []string{}
+		} else {
+			dbNames = res.([]string)
+		}
+		return redrawView(g, treeView)
+	})
+}
+
+// keyPage is a page of keys with their TTLs
+type keyPage struct {
+	keys []string
+	ttls map[string]time.Duration
+}
+
+// loadKeys fetches the next page of keys of the current database
+func loadKeys(g *gocui.Gui) {
+	if treeLoading {
+		return
+	}
+	if treeIter == nil {
+		pattern := "*"
+		if treeFilter != nil {
+			pattern = treeFilter.pattern
+		}
+		treeIter = kv.NewKeyIterator(kvstore, pattern, *pageSize)
+	}
+	it, f := treeIter, treeFilter
+	treeLoading = true
+	kvfetch.fetch("keys", func(ctx context.Context, store kv.KV) (interface{}, error) {
+		if it.Next(ctx) {
+			return &keyPage{keys: it.Keys(), ttls: fetchTTLs(ctx, store, it.Keys())}, nil
+		}
+		return nil, it.Err()
+	}, func(g *gocui.Gui, res interface{}, err error) error {
+		if it != treeIter {
+			// the keys were reset while fetching
+			return nil
+		}
+		treeLoading = false
+		if err != nil {
+			showError(g, err)
+		} else if page, ok := res.(*keyPage); ok {
+			for _, k := range page.keys {
+				if f.match(k) {
+					treeRoot.insert(k)
+				}
+			}
+			for k, ttl := range page.ttls {
+				setExpiry(k, ttl)
+			}
+			if len(page.keys) == 0 && !it.Done() {
+				// no keys matched in this round, scan on with a
+				// deadline of its own
+				loadKeys(g)
+			}
+		}
+		return redrawView(g, treeView)
+	})
+}
+
+// resetKeys drops the fetched keys, so they are fetched again on render
+func resetKeys() {
+	treeRoot = newNamespace("", "")
+	treeIter = nil
+	treeLoading = false
+	expanded = make(map[string]bool)
+	expiries = make(map[string]time.Time)
+}
+
+// keyCount returns the number of fetched keys in namespace n, with a +
+// while more keys are fetched
+func keyCount(n *nsNode) string {
+	if treeIter != nil && !treeIter.Done() {
+		return fmt.Sprintf("%d+", n.count)
+	}
+	return fmt.Sprint(n.count)
+}
+
+// renderNamespace renders the child namespaces and keys of n, child
+// namespaces are only rendered when expanded
+func renderNamespace(v *gocui.View, n *nsNode, db int, depth int) {
+	ind := strings.Repeat(indent, depth)
+	for _, name := range n.childNames() {
+		c := n.children[name]
+		marker := "+"
+		if expanded[c.path] {
+			marker = "-"
+		}
+		fmt.Fprintf(v, "%s%s%s %s (%s)\n", ind, nsPrefix, marker, treeFilter.highlight(c.path, len(n.path)), keyCount(c))
+		treeLines = append(treeLines, treeLine{db: db, ns: c.path})
+		if expanded[c.path] {
+			renderNamespace(v, c, db, depth+1)
+		}
+	}
+	for _, k := range n.keys {
+		fmt.Fprintf(v, "%s%s%s%s\n", ind, keyPrefix, treeFilter.highlight(k, len(n.path)), ttlSuffix(k))
+		treeLines = append(treeLines, treeLine{db: db, key: k})
+	}
+}
+
+func renderTree(g *gocui.Gui, v *gocui.View) error {
+	v.Clear()
+	treeLines = treeLines[:0]
+	v.Title = ""
+	if treeFilter != nil {
+		v.Title = "/" + treeFilter.input
+	}
+	if dbNames == nil {
+		if !dbLoading {
+			loadDatabases(g)
+		}
+		fmt.Fprintln(v, loading)
+		return nil
+	}
+	prefix := dbPrefix
+	if c, ok := kvstore.(kv.Clusterer); ok && c.Cluster() {
+		prefix = nodePrefix
+	}
+	for i, name := range dbNames {
+		if i == currentDb {
+			fmt.Fprintf(v, "-%s%s\n", prefix, printable(name))
+			treeLines = append(treeLines, treeLine{db: i})
+			if treeIter == nil {
+				loadKeys(g)
+			}
+			renderNamespace(v, treeRoot, i, 0)
+			if treeLoading {
+				fmt.Fprintf(v, "%s%s\n", keyPrefix, loading)
+				treeLines = append(treeLines, treeLine{db: i})
+			} else if !treeIter.Done() && treeIter.Err() == nil {
+				fmt.Fprintf(v, "%s%s\n", keyPrefix, moreKeys)
+				treeLines = append(treeLines, treeLine{db: i, more: true})
+			}
+		} else {
+			fmt.Fprintf(v, "+%s%s\n", prefix, printable(name))
+			treeLines = append(treeLines, treeLine{db: i})
+		}
+	}
+
+	key := ""
+	_, pos := v.Cursor()
+	_, oy := v.Origin()
+	if l := pos + oy; l < len(treeLines) {
+		if treeLines[l].more {
+			// the cursor reached the end of the fetched keys, fetch the next page
+			loadKeys(g)
+		}
+		key = treeLines[l].key
+	}
+	if key != currentKey {
+		currentKey = key
+		loadValue(g)
+	}
+	return nil
+}
+
+// setLine moves the cursor to line l of view v, scrolling it
+// into view when needed
+func setLine(v *gocui.View, l int) {
+	_, h := v.Size()
+	_, oy := v.Origin()
+	if l < oy || l >= oy+h {
+		oy = l - h/2
+		if oy < 0 {
+			oy = 0
+		}
+		v.SetOrigin(0, oy)
+	}
+	v.SetCursor(0, l-oy)
+}
+
+// selectKey moves the cursor of the tree view to key, the namespaces
+// holding key are expanded
+func selectKey(g *gocui.Gui, key string) error {
+	v, err := g.View(treeView)
+	if err != nil {
+		return err
+	}
+	for i, d := 0, *delimiter; d != ""; {
+		j := strings.Index(key[i:], d)
+		if j < 0 {
+			break
+		}
+		i += j + len(d)
+		expanded[key[:i]] = true
+	}
+	renderTree(g, v)
+	for l, line := range treeLines {
+		if line.key == key {
+			setLine(v, l)
+			break
+		}
+	}
+	return renderTree(g, v)
+}
+
+// treeSelect expands or collapses the database or namespace under the cursor
+func treeSelect(g *gocui.Gui, v *gocui.View) error {
+	if v.Name() != treeView {
+		return nil
+	}
+	_, pos := v.Cursor()
+	_, oy := v.Origin()
+	l := pos + oy
+	if l >= len(treeLines) {
+		return nil
+	}
+	line := treeLines[l]
+	switch {
+	case line.ns != "":
+		expanded[line.ns] = !expanded[line.ns]
+		return renderTree(g, v)
+	case line.key == "" && !line.more && line.db != currentDb:
+		db := line.db
+		kvfetch.fetch("database", func(ctx context.Context, store kv.KV) (interface{}, error) {
+			return nil, store.Database(ctx, db)
+		}, func(g *gocui.Gui, res interface{}, err error) error {
+			if err != nil {
+				showError(g, err)
+				return nil
+			}
+			currentDb = db
+			resetKeys()
+			return redrawView(g, treeView)
+		})
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rikvdh/kvui/kv"
+	"github.com/rikvdh/kvui/kv/ramkv"
+)
+
+func TestKeyCount(t *testing.T) {
+	ctx := context.Background()
+	store, _ := ramkv.New()
+	for _, k := range []string{"user:1", "user:2", "user:3"} {
+		store.Set(ctx, k, "value")
+	}
+	defer func() { treeIter = nil }()
+
+	ns := newNamespace("", "")
+	treeIter = kv.NewKeyIterator(store, "*", 2)
+	for treeIter.Next(ctx) {
+		for _, k := range treeIter.Keys() {
+			ns.insert(k)
+		}
+		user := ns.children["user"]
+		if c := keyCount(user); !treeIter.Done() && c != "2+" {
+			t.Errorf("keyCount = %q while fetching, want 2+", c)
+		}
+	}
+	if c := keyCount(ns.children["user"]); c != "3" {
+		t.Errorf("keyCount = %q, want 3", c)
+	}
+}
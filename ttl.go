@@ -0,0 +1,136 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/jroimartin/gocui"
+	"github.com/rikvdh/kvui/kv"
+)
+
+const (
+	dimStart = "\x1b[38;5;243m"
+	dimEnd   = "\x1b[0m"
+)
+
+// expiries holds when the keys in the tree expire, keys without
+// expiration are not in it
+var expiries = make(map[string]time.Time)
+
+// setExpiry records that key expires after ttl, a negative ttl means it
+// does not expire
+func setExpiry(key string, ttl time.Duration) {
+	if ttl < 0 {
+		delete(expiries, key)
+		return
+	}
+	expiries[key] = time.Now().Add(ttl)
+}
+
+// fetchTTLs fetches the TTL of keys, keys without expiration get a
+// negative TTL. Backends that can't tell the TTL result in no TTLs.
+func fetchTTLs(ctx context.Context, store kv.KV, keys []string) map[string]time.Duration {
+	if b, ok := store.(kv.TTLBatcher); ok {
+		ttls, _ := b.TTLs(ctx, keys)
+		return ttls
+	}
+	ttls := make(map[string]time.Duration, len(keys))
+	for _, k := range keys {
+		ttl, err := store.TTL(ctx, k)
+		if err == kv.ErrNotSupported || ctx.Err() != nil {
+			break
+		}
+		if err == nil {
+			ttls[k] = ttl
+		}
+	}
+	return ttls
+}
+
+// formatTTL returns the time left before key expires, or "" when it does
+// not expire
+func formatTTL(key string) string {
+	exp, ok := expiries[key]
+	if !ok {
+		return ""
+	}
+	left := exp.Sub(time.Now())
+	if left <= 0 {
+		return "expired"
+	}
+	return (time.Duration(math.Ceil(left.Seconds())) * time.Second).String()
+}
+
+// ttlSuffix returns the dimmed TTL shown behind key in the tree view
+func ttlSuffix(key string) string {
+	ttl := formatTTL(key)
+	if ttl == "" {
+		return ""
+	}
+	return " " + dimStart + ttl + dimEnd
+}
+
+// parseTTL parses a TTL as duration (90s, 1h) or whole seconds. The TTL
+// must be at least a millisecond, an expiration of 0 deletes the key.
+func parseTTL(s string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(s)
+	if err != nil {
+		secs, serr := strconv.Atoi(s)
+		if serr != nil {
+			return 0, fmt.Errorf("invalid ttl: %s", s)
+		}
+		ttl = time.Duration(secs) * time.Second
+	}
+	if ttl < time.Millisecond {
+		return 0, fmt.Errorf("invalid ttl: %s, it must be at least 1ms", s)
+	}
+	return ttl, nil
+}
+
+// editTTL asks for the TTL of the selected key, an empty TTL removes the
+// expiration
+func editTTL(g *gocui.Gui, v *gocui.View) error {
+	if !writable(g) {
+		return nil
+	}
+	key := currentKey
+	if key == "" {
+		return nil
+	}
+	ttl := formatTTL(key)
+	if ttl == "expired" {
+		ttl = ""
+	}
+	return prompt(g, "TTL of "+printable(key)+" (90s, 1h, empty removes it)", ttl, func(g *gocui.Gui, input string) error {
+		ttl := time.Duration(-1)
+		if input != "" {
+			var err error
+			if ttl, err = parseTTL(input); err != nil {
+				showError(g, err)
+				return nil
+			}
+		}
+		kvfetch.fetch("", func(ctx context.Context, store kv.KV) (interface{}, error) {
+			if ttl < 0 {
+				return nil, store.Persist(ctx, key)
+			}
+			return nil, store.Expire(ctx, key, ttl)
+		}, func(g *gocui.Gui, res interface{}, err error) error {
+			if err != nil {
+				showError(g, err)
+				return nil
+			}
+			setExpiry(key, ttl)
+			redrawView(g, valueView)
+			return redrawView(g, treeView)
+		})
+		return nil
+	})
+}
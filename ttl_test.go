@@ -0,0 +1,34 @@
+// Copyright 2017 The KVUI Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		in  string
+		ttl time.Duration
+		ok  bool
+	}{
+		{"90", 90 * time.Second, true},
+		{"1h30m", 90 * time.Minute, true},
+		{"1ms", time.Millisecond, true},
+		{"0", 0, false},
+		{"0s", 0, false},
+		{"-5", 0, false},
+		{"-1m", 0, false},
+		{"500us", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		ttl, err := parseTTL(tt.in)
+		if (err == nil) != tt.ok || ttl != tt.ttl {
+			t.Errorf("parseTTL(%q) = %s, %v", tt.in, ttl, err)
+		}
+	}
+}